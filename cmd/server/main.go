@@ -1,27 +1,35 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"golang.org/x/time/rate"
 
 	"github.com/secure-storage/internal/api"
+	"github.com/secure-storage/internal/logging"
 	"github.com/secure-storage/internal/storage"
 )
 
 // Simple in-memory rate limiter store
 type RateLimiter struct {
-	visitors map[string]*rate.Limiter
-	mu       sync.Mutex
+	visitors       map[string]*rate.Limiter
+	mu             sync.Mutex
+	trustedProxies []*net.IPNet
 }
 
-func NewRateLimiter() *RateLimiter {
+func NewRateLimiter(trustedProxies []*net.IPNet) *RateLimiter {
 	return &RateLimiter{
-		visitors: make(map[string]*rate.Limiter),
+		visitors:       make(map[string]*rate.Limiter),
+		trustedProxies: trustedProxies,
 	}
 }
 
@@ -41,7 +49,7 @@ func (rl *RateLimiter) getLimiter(ip string) *rate.Limiter {
 // Middleware to intercept requests
 func (rl *RateLimiter) Limit(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip := r.RemoteAddr // In production, use X-Forwarded-For if behind a proxy
+		ip := logging.ClientIP(r, rl.trustedProxies)
 		limiter := rl.getLimiter(ip)
 		if !limiter.Allow() {
 			http.Error(w, "Too Many Requests - Slow Down", http.StatusTooManyRequests)
@@ -51,6 +59,41 @@ func (rl *RateLimiter) Limit(next http.Handler) http.Handler {
 	})
 }
 
+// newBackend selects a storage.Backend based on the STORAGE_BACKEND
+// environment variable ("local", "s3", or "azure"), defaulting to local
+// disk storage under ./data.
+func newBackend() (storage.Backend, error) {
+	switch backendType := os.Getenv("STORAGE_BACKEND"); backendType {
+	case "", "local":
+		dataDir := "./data"
+		if err := os.MkdirAll(dataDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create data directory: %w", err)
+		}
+		return storage.NewLocalBackend(dataDir), nil
+
+	case "s3":
+		bucket := os.Getenv("S3_BUCKET")
+		usePathStyle, _ := strconv.ParseBool(os.Getenv("S3_USE_PATH_STYLE"))
+		return storage.NewS3Backend(context.Background(), storage.S3BackendConfig{
+			Bucket:       bucket,
+			Prefix:       os.Getenv("S3_PREFIX"),
+			Endpoint:     os.Getenv("S3_ENDPOINT"),
+			Region:       os.Getenv("S3_REGION"),
+			UsePathStyle: usePathStyle,
+		})
+
+	case "azure":
+		return storage.NewAzureBlobBackend(
+			os.Getenv("AZURE_STORAGE_CONNECTION_STRING"),
+			os.Getenv("AZURE_CONTAINER"),
+			os.Getenv("AZURE_PREFIX"),
+		)
+
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %q (want local, s3, or azure)", backendType)
+	}
+}
+
 func main() {
 	// Get encryption key from environment variable
 	encryptionKey := os.Getenv("STORAGE_KEY")
@@ -63,14 +106,21 @@ func main() {
 		log.Fatal("STORAGE_KEY must be exactly 32 characters for AES-256")
 	}
 
-	// Create data directory if it doesnt exist
-	dataDir := "./data"
-	if err := os.MkdirAll(dataDir, 0755); err != nil {
-		log.Fatalf("Failed to create data directory: %v", err)
+	backend, err := newBackend()
+	if err != nil {
+		log.Fatalf("Failed to initialize storage backend: %v", err)
 	}
 
-	// Initialize the storage service
-	storageService, err := storage.NewService(encryptionKey, dataDir)
+	// Initialize the storage service. STORAGE_DEDUP opts into
+	// content-addressed chunk deduplication (see internal/storage/dedup.go)
+	// instead of the default one-object-per-file layout.
+	dedup, _ := strconv.ParseBool(os.Getenv("STORAGE_DEDUP"))
+	var storageService *storage.Service
+	if dedup {
+		storageService, err = storage.NewServiceWithDedup(encryptionKey, backend)
+	} else {
+		storageService, err = storage.NewServiceWithBackend(encryptionKey, backend)
+	}
 	if err != nil {
 		log.Fatalf("Failed to initialize storage service: %v", err)
 	}
@@ -82,10 +132,28 @@ func main() {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/upload", handler.UploadHandler)
 	mux.HandleFunc("/download/", handler.DownloadHandler)
+	mux.HandleFunc("/upload/pgp", handler.UploadPGPHandler)
+	mux.HandleFunc("/download/pgp/", handler.DownloadPGPHandler)
+	mux.HandleFunc("/share/", handler.ShareHandler)
+	mux.HandleFunc("/revoke/", handler.RevokeHandler)
 	mux.HandleFunc("/health", handler.HealthHandler)
 
+	// TRUSTED_PROXIES (comma-separated IPs/CIDRs) lets the access log and
+	// rate limiter trust X-Forwarded-For from known reverse proxies rather
+	// than the raw TCP peer, which is all they'd see behind one otherwise.
+	trustedProxies, err := logging.ParseTrustedProxies(strings.Split(os.Getenv("TRUSTED_PROXIES"), ","))
+	if err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
+	sink, err := logging.Sink(os.Getenv("LOG_FILE"))
+	if err != nil {
+		log.Fatalf("Failed to open access log: %v", err)
+	}
+	accessLog := logging.NewLogger(sink, trustedProxies)
+
 	// *** SECURITY UPGRADE: Apply Rate Limiter ***
-	limiter := NewRateLimiter()
+	limiter := NewRateLimiter(trustedProxies)
 
 	// Cleanup old visitors every minute (Prevent memory leaks)
 	go func() {
@@ -104,9 +172,9 @@ func main() {
 	}
 
 	log.Printf("Starting SecureStorage server on port %s", port)
-	log.Printf("Endpoints: POST /upload, GET /download/{filename}, GET /health")
+	log.Printf("Endpoints: POST /upload, GET /download/{filename}, POST /upload/pgp, GET /download/pgp/{filename}, POST /share/{filename}, POST /revoke/{filename}, GET /health")
 
-	if err := http.ListenAndServe(":"+port, limiter.Limit(mux)); err != nil {
+	if err := http.ListenAndServe(":"+port, accessLog.LogHandler(limiter.Limit(mux))); err != nil {
 		log.Fatalf("Server failed to start: %v", err)
 	}
 }
@@ -1,11 +1,18 @@
 package api
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 
+	"github.com/secure-storage/internal/logging"
+	"github.com/secure-storage/internal/pgp"
 	"github.com/secure-storage/internal/storage"
 )
 
@@ -69,9 +76,18 @@ func (h *Handler) UploadHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	// Save and encrypt the file
+	// Save and encrypt the file. A client-supplied X-Encrypt-Password
+	// routes to a per-file scrypt-derived key instead of the global
+	// STORAGE_KEY, mirroring transfer.sh's X-Encrypt-Password header.
 	filename := header.Filename
-	if err := h.storage.SaveFile(filename, file); err != nil {
+	r = r.WithContext(logging.WithField(r.Context(), "filename", filename))
+	password := r.Header.Get("X-Encrypt-Password")
+	if password != "" {
+		err = h.storage.SaveFileWithPassword(filename, file, password)
+	} else {
+		err = h.storage.SaveFile(filename, file)
+	}
+	if err != nil {
 		log.Printf("Error saving file %s: %v", filename, err)
 		sendJSON(w, http.StatusBadRequest, response{
 			Success: false,
@@ -118,11 +134,34 @@ func (h *Handler) DownloadHandler(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	r = r.WithContext(logging.WithField(r.Context(), "filename", filename))
 
-	// Load and decrypt the file
-	data, err := h.storage.LoadFile(filename)
+	protected, err := h.storage.IsPasswordProtected(filename)
 	if err != nil {
-		log.Printf("Error loading file %s: %v", filename, err)
+		log.Printf("Error checking file %s: %v", filename, err)
+		if strings.Contains(err.Error(), "not found") {
+			sendJSON(w, http.StatusNotFound, response{
+				Success: false,
+				Error:   "file not found",
+			})
+		} else {
+			sendJSON(w, http.StatusBadRequest, response{
+				Success: false,
+				Error:   err.Error(),
+			})
+		}
+		return
+	}
+
+	if protected {
+		h.downloadPasswordProtected(w, r, filename)
+		return
+	}
+
+	// Open a streaming decryptor so we never buffer the whole plaintext
+	rc, err := h.storage.OpenFile(filename)
+	if err != nil {
+		log.Printf("Error opening file %s: %v", filename, err)
 
 		// Return 404 for not found, 400 for other errors
 		if strings.Contains(err.Error(), "not found") {
@@ -138,16 +177,348 @@ func (h *Handler) DownloadHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	defer rc.Close()
 
 	// Set headers for file download
 	w.Header().Set("Content-Type", "application/octet-stream")
 	w.Header().Set("Content-Disposition", "attachment; filename=\""+filename+"\"")
+	if size, err := h.storage.FileSize(filename); err == nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	}
 
-	// Stream the decrypted file back
-	w.Write(data)
+	// Stream the decrypted file straight to the client
+	if _, err := io.Copy(w, rc); err != nil {
+		log.Printf("Error streaming file %s: %v", filename, err)
+		return
+	}
 	log.Printf("Successfully downloaded: %s", filename)
 }
 
+// downloadPasswordProtected handles GET /download/{filename} for files
+// saved via SaveFileWithPassword. The same X-Encrypt-Password header used
+// on upload must be supplied again, and a missing or wrong password is
+// reported as 401 rather than leaking whether the data itself is corrupt.
+func (h *Handler) downloadPasswordProtected(w http.ResponseWriter, r *http.Request, filename string) {
+	password := r.Header.Get("X-Encrypt-Password")
+	if password == "" {
+		sendJSON(w, http.StatusUnauthorized, response{
+			Success: false,
+			Error:   "this file is password-protected; X-Encrypt-Password header is required",
+		})
+		return
+	}
+
+	// Open a streaming decryptor so we never buffer the whole plaintext
+	rc, err := h.storage.OpenFileWithPassword(filename, password)
+	if err != nil {
+		log.Printf("Error opening password-protected file %s: %v", filename, err)
+		if errors.Is(err, storage.ErrWrongPassword) {
+			sendJSON(w, http.StatusUnauthorized, response{
+				Success: false,
+				Error:   "wrong password",
+			})
+		} else {
+			sendJSON(w, http.StatusBadRequest, response{
+				Success: false,
+				Error:   err.Error(),
+			})
+		}
+		return
+	}
+	defer rc.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+filename+"\"")
+
+	// Stream the decrypted file straight to the client
+	if _, err := io.Copy(w, rc); err != nil {
+		log.Printf("Error streaming password-protected file %s: %v", filename, err)
+		return
+	}
+	log.Printf("Successfully downloaded password-protected file: %s", filename)
+}
+
+// UploadPGPHandler handles POST /upload/pgp requests. Unlike UploadHandler,
+// the file is OpenPGP-encrypted for a client-supplied public key before it
+// reaches storage, and stored verbatim via SaveEncryptedBlob rather than
+// under the service's own STORAGE_KEY -- so a compromised STORAGE_KEY
+// alone can't expose it.
+func (h *Handler) UploadPGPHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendJSON(w, http.StatusMethodNotAllowed, response{
+			Success: false,
+			Error:   "method not allowed, use POST",
+		})
+		return
+	}
+
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		log.Printf("Error parsing form: %v", err)
+		sendJSON(w, http.StatusBadRequest, response{
+			Success: false,
+			Error:   "failed to parse form data",
+		})
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		log.Printf("Error getting file from form: %v", err)
+		sendJSON(w, http.StatusBadRequest, response{
+			Success: false,
+			Error:   "no file provided in 'file' field",
+		})
+		return
+	}
+	defer file.Close()
+
+	publicKey, err := pgpPublicKeyFromRequest(r)
+	if err != nil {
+		sendJSON(w, http.StatusBadRequest, response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	filename := header.Filename
+	r = r.WithContext(logging.WithField(r.Context(), "filename", filename))
+
+	ciphertext, err := pgp.Encrypt(file, publicKey)
+	if err != nil {
+		log.Printf("Error PGP-encrypting file %s: %v", filename, err)
+		sendJSON(w, http.StatusBadRequest, response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if err := h.storage.SaveEncryptedBlob(filename, bytes.NewReader(ciphertext)); err != nil {
+		log.Printf("Error saving PGP blob %s: %v", filename, err)
+		sendJSON(w, http.StatusBadRequest, response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	log.Printf("Successfully uploaded and PGP-encrypted: %s", filename)
+	sendJSON(w, http.StatusOK, response{
+		Success: true,
+		Message: "file uploaded and PGP-encrypted successfully",
+	})
+}
+
+// DownloadPGPHandler handles GET /download/pgp/{filename} requests,
+// decrypting the stored OpenPGP message with a client-supplied private key
+// (and passphrase, if the key needs one) so the plaintext never has to be
+// reconstructed by anyone holding only STORAGE_KEY.
+func (h *Handler) DownloadPGPHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendJSON(w, http.StatusMethodNotAllowed, response{
+			Success: false,
+			Error:   "method not allowed, use GET",
+		})
+		return
+	}
+
+	filename := strings.TrimPrefix(r.URL.Path, "/download/pgp/")
+	if filename == "" {
+		sendJSON(w, http.StatusBadRequest, response{
+			Success: false,
+			Error:   "filename is required",
+		})
+		return
+	}
+	r = r.WithContext(logging.WithField(r.Context(), "filename", filename))
+
+	privateKey, passphrase, err := pgpPrivateKeyFromRequest(r)
+	if err != nil {
+		sendJSON(w, http.StatusBadRequest, response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	ciphertext, err := h.storage.LoadEncryptedBlob(filename)
+	if err != nil {
+		log.Printf("Error loading PGP blob %s: %v", filename, err)
+		if strings.Contains(err.Error(), "not found") {
+			sendJSON(w, http.StatusNotFound, response{
+				Success: false,
+				Error:   "file not found",
+			})
+		} else {
+			sendJSON(w, http.StatusBadRequest, response{
+				Success: false,
+				Error:   err.Error(),
+			})
+		}
+		return
+	}
+
+	plaintext, err := pgp.Decrypt(ciphertext, privateKey, passphrase)
+	if err != nil {
+		log.Printf("Error PGP-decrypting file %s: %v", filename, err)
+		sendJSON(w, http.StatusUnauthorized, response{
+			Success: false,
+			Error:   "failed to decrypt with the supplied key/passphrase",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+filename+"\"")
+	w.Header().Set("Content-Length", strconv.Itoa(len(plaintext)))
+	w.Write(plaintext)
+	log.Printf("Successfully downloaded and PGP-decrypted: %s", filename)
+}
+
+// pgpPublicKeyFromRequest reads an armored OpenPGP public key from the
+// "public_key" multipart field, falling back to the base64-encoded
+// X-PGP-Public-Key header (base64 so the armored block's newlines survive
+// a header value).
+func pgpPublicKeyFromRequest(r *http.Request) (string, error) {
+	if key := r.FormValue("public_key"); key != "" {
+		return key, nil
+	}
+	if encoded := r.Header.Get("X-PGP-Public-Key"); encoded != "" {
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return "", errors.New("X-PGP-Public-Key must be base64-encoded")
+		}
+		return string(decoded), nil
+	}
+	return "", errors.New("an OpenPGP public key is required (public_key form field or X-PGP-Public-Key header)")
+}
+
+// pgpPrivateKeyFromRequest reads an armored OpenPGP private key and
+// optional passphrase from request headers (a GET request has no body to
+// carry a multipart field).
+func pgpPrivateKeyFromRequest(r *http.Request) (armoredPrivateKey, passphrase string, err error) {
+	encoded := r.Header.Get("X-PGP-Private-Key")
+	if encoded == "" {
+		return "", "", errors.New("X-PGP-Private-Key header is required")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", errors.New("X-PGP-Private-Key must be base64-encoded")
+	}
+	return string(decoded), r.Header.Get("X-PGP-Passphrase"), nil
+}
+
+// shareRequest is the JSON body expected by ShareHandler and RevokeHandler.
+type shareRequest struct {
+	PublicKey string `json:"public_key"` // base64-encoded raw 32-byte X25519 public key
+}
+
+// ShareHandler handles POST /share/{filename} requests, granting the
+// recipient named by the request body read access to the file without
+// re-encrypting it.
+func (h *Handler) ShareHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendJSON(w, http.StatusMethodNotAllowed, response{
+			Success: false,
+			Error:   "method not allowed, use POST",
+		})
+		return
+	}
+
+	filename := strings.TrimPrefix(r.URL.Path, "/share/")
+	if filename == "" {
+		sendJSON(w, http.StatusBadRequest, response{
+			Success: false,
+			Error:   "filename is required",
+		})
+		return
+	}
+
+	pubKey, err := decodeSharePublicKey(r)
+	if err != nil {
+		sendJSON(w, http.StatusBadRequest, response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if err := h.storage.GrantAccess(filename, pubKey); err != nil {
+		log.Printf("Error granting access to %s: %v", filename, err)
+		sendJSON(w, http.StatusBadRequest, response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	log.Printf("Granted access to %s", filename)
+	sendJSON(w, http.StatusOK, response{
+		Success: true,
+		Message: "access granted",
+	})
+}
+
+// RevokeHandler handles POST /revoke/{filename} requests, removing a
+// recipient's access and rotating the file key for everyone else.
+func (h *Handler) RevokeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendJSON(w, http.StatusMethodNotAllowed, response{
+			Success: false,
+			Error:   "method not allowed, use POST",
+		})
+		return
+	}
+
+	filename := strings.TrimPrefix(r.URL.Path, "/revoke/")
+	if filename == "" {
+		sendJSON(w, http.StatusBadRequest, response{
+			Success: false,
+			Error:   "filename is required",
+		})
+		return
+	}
+
+	pubKey, err := decodeSharePublicKey(r)
+	if err != nil {
+		sendJSON(w, http.StatusBadRequest, response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if err := h.storage.RevokeAccess(filename, pubKey); err != nil {
+		log.Printf("Error revoking access to %s: %v", filename, err)
+		sendJSON(w, http.StatusBadRequest, response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	log.Printf("Revoked access to %s", filename)
+	sendJSON(w, http.StatusOK, response{
+		Success: true,
+		Message: "access revoked",
+	})
+}
+
+// decodeSharePublicKey reads and base64-decodes the public_key field from
+// a share/revoke request body.
+func decodeSharePublicKey(r *http.Request) ([]byte, error) {
+	var req shareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, errors.New("failed to parse request body")
+	}
+	pubKey, err := base64.StdEncoding.DecodeString(req.PublicKey)
+	if err != nil {
+		return nil, errors.New("public_key must be base64-encoded")
+	}
+	return pubKey, nil
+}
+
 // HealthHandler handles GET /health requests for container health checks
 func (h *Handler) HealthHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
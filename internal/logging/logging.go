@@ -0,0 +1,236 @@
+// Package logging provides a structured JSON access log middleware,
+// modeled on the access logging approach in minio: one JSON line per
+// request, written to stdout or a rotating file, with enough per-request
+// metadata (remote IP, request ID, status, duration, ...) to reconstruct
+// what happened without grepping plaintext log lines.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Logger emits one JSON line per HTTP request via LogHandler.
+type Logger struct {
+	sink           io.Writer
+	sinkMu         sync.Mutex
+	trustedProxies []*net.IPNet
+}
+
+// NewLogger creates a Logger that writes JSON lines to sink, treating the
+// given CIDRs/IPs as trusted proxies for X-Forwarded-For purposes (see
+// ClientIP).
+func NewLogger(sink io.Writer, trustedProxies []*net.IPNet) *Logger {
+	return &Logger{sink: sink, trustedProxies: trustedProxies}
+}
+
+// ClientIP returns l's best-effort client IP for r (see the package-level
+// ClientIP for the extraction rules).
+func (l *Logger) ClientIP(r *http.Request) string {
+	return ClientIP(r, l.trustedProxies)
+}
+
+// ParseTrustedProxies parses a list of IPs or CIDRs (e.g. from a
+// comma-separated TRUSTED_PROXIES environment variable) into the form
+// ClientIP expects. Blank entries are ignored.
+func ParseTrustedProxies(entries []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+			if ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, cidr, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		nets = append(nets, cidr)
+	}
+	return nets, nil
+}
+
+// ClientIP returns the request's client IP: if the direct peer
+// (r.RemoteAddr) is a trusted proxy, the right-most untrusted entry of
+// X-Forwarded-For is used instead (so a spoofed left-most entry from the
+// real client can't be trusted); otherwise r.RemoteAddr is used as-is.
+func ClientIP(r *http.Request, trustedProxies []*net.IPNet) string {
+	remoteHost, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remoteHost = r.RemoteAddr
+	}
+
+	if !isTrustedProxy(remoteHost, trustedProxies) {
+		return remoteHost
+	}
+
+	xff := r.Header.Get("X-Forwarded-For")
+	if xff == "" {
+		return remoteHost
+	}
+
+	hops := strings.Split(xff, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		candidate := strings.TrimSpace(hops[i])
+		if candidate == "" {
+			continue
+		}
+		if !isTrustedProxy(candidate, trustedProxies) {
+			return candidate
+		}
+	}
+	return remoteHost
+}
+
+func isTrustedProxy(host string, trustedProxies []*net.IPNet) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range trustedProxies {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldsKey is the context key a request's mutable extra-fields map is
+// stored under.
+type fieldsKeyType struct{}
+
+var fieldsKey fieldsKeyType
+
+// fields is the mutable bag WithField writes into. It's stored in the
+// request context as a pointer so that a handler calling
+// r.WithContext(...) (which returns a new *http.Request, not visible to
+// the middleware that's still holding the original one) still mutates the
+// same map LogHandler reads back after next.ServeHTTP returns.
+type fields struct {
+	mu sync.Mutex
+	m  map[string]string
+}
+
+// WithField annotates ctx with a key/value pair that LogHandler will
+// include in that request's log line, e.g.
+// r = r.WithContext(logging.WithField(r.Context(), "filename", name))
+// Calling this on a context not produced by LogHandler is a harmless
+// no-op; the field is simply dropped.
+func WithField(ctx context.Context, key, value string) context.Context {
+	if f, ok := ctx.Value(fieldsKey).(*fields); ok {
+		f.mu.Lock()
+		f.m[key] = value
+		f.mu.Unlock()
+	}
+	return ctx
+}
+
+// statusWriter wraps an http.ResponseWriter to capture the status code and
+// byte count a handler wrote, neither of which http.ResponseWriter exposes
+// directly.
+type statusWriter struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	sw.status = status
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	n, err := sw.ResponseWriter.Write(b)
+	sw.written += int64(n)
+	return n, err
+}
+
+// LogHandler wraps next, emitting one JSON line per request to l's sink
+// with the request's start time, method, path, client IP, user agent,
+// request ID, status code, bytes written, duration, and any fields a
+// handler attached via WithField.
+func (l *Logger) LogHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		requestID := r.Header.Get("X-Request-ID")
+		if requestID == "" {
+			requestID = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+
+		f := &fields{m: make(map[string]string)}
+		r = r.WithContext(context.WithValue(r.Context(), fieldsKey, f))
+
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		entry := map[string]interface{}{
+			"time":        start.UTC().Format(time.RFC3339Nano),
+			"request_id":  requestID,
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"remote_ip":   l.ClientIP(r),
+			"user_agent":  r.UserAgent(),
+			"status":      status,
+			"bytes":       sw.written,
+			"duration_ms": time.Since(start).Milliseconds(),
+		}
+
+		f.mu.Lock()
+		for k, v := range f.m {
+			entry[k] = v
+		}
+		f.mu.Unlock()
+
+		line, err := json.Marshal(entry)
+		if err != nil {
+			// A log line we can't encode must never take down the request
+			// it's describing; just drop it.
+			return
+		}
+
+		l.sinkMu.Lock()
+		fmt.Fprintln(l.sink, string(line))
+		l.sinkMu.Unlock()
+	})
+}
+
+// newRequestID generates an RFC 4122 version 4 UUID for requests that
+// don't already carry an X-Request-ID.
+func newRequestID() string {
+	var b [16]byte
+	// crypto/rand.Read only fails on an unusable OS RNG, which would mean
+	// the process can't do crypto at all; a mostly-zero ID in that case is
+	// harmless since nothing else in the process would be working either.
+	rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,127 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLogHandlerEmitsRequestMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, nil)
+
+	handler := logger.LogHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/download/file.txt", nil)
+	req.RemoteAddr = "203.0.113.1:54321"
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &entry); err != nil {
+		t.Fatalf("log line is not valid JSON: %v (line: %q)", err, buf.String())
+	}
+
+	if entry["method"] != http.MethodGet {
+		t.Errorf("method = %v, want GET", entry["method"])
+	}
+	if entry["path"] != "/download/file.txt" {
+		t.Errorf("path = %v, want /download/file.txt", entry["path"])
+	}
+	if entry["remote_ip"] != "203.0.113.1" {
+		t.Errorf("remote_ip = %v, want 203.0.113.1", entry["remote_ip"])
+	}
+	if entry["status"] != float64(http.StatusTeapot) {
+		t.Errorf("status = %v, want %d", entry["status"], http.StatusTeapot)
+	}
+	if entry["bytes"] != float64(len("short and stout")) {
+		t.Errorf("bytes = %v, want %d", entry["bytes"], len("short and stout"))
+	}
+	if entry["request_id"] == "" || entry["request_id"] == nil {
+		t.Error("request_id is empty, want a generated UUID")
+	}
+}
+
+func TestLogHandlerPreservesSuppliedRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, nil)
+
+	handler := logger.LogHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set("X-Request-ID", "fixed-request-id")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &entry); err != nil {
+		t.Fatalf("log line is not valid JSON: %v", err)
+	}
+	if entry["request_id"] != "fixed-request-id" {
+		t.Errorf("request_id = %v, want fixed-request-id", entry["request_id"])
+	}
+	if got := rr.Header().Get("X-Request-ID"); got != "fixed-request-id" {
+		t.Errorf("response X-Request-ID = %q, want fixed-request-id", got)
+	}
+}
+
+func TestLogHandlerIncludesHandlerAttachedFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, nil)
+
+	handler := logger.LogHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := WithField(r.Context(), "filename", "report.txt")
+		r = r.WithContext(ctx)
+		_ = r
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &entry); err != nil {
+		t.Fatalf("log line is not valid JSON: %v", err)
+	}
+	if entry["filename"] != "report.txt" {
+		t.Errorf("filename = %v, want report.txt", entry["filename"])
+	}
+}
+
+func TestClientIPHonorsTrustedProxy(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.5:1234"
+	req.Header.Set("X-Forwarded-For", "198.51.100.9, 10.0.0.5")
+
+	if ip := ClientIP(req, trusted); ip != "198.51.100.9" {
+		t.Errorf("ClientIP = %q, want 198.51.100.9", ip)
+	}
+}
+
+func TestClientIPIgnoresForwardedForFromUntrustedPeer(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "198.51.100.9:1234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.1")
+
+	if ip := ClientIP(req, nil); ip != "198.51.100.9" {
+		t.Errorf("ClientIP = %q, want direct peer 198.51.100.9 since no proxy is trusted", ip)
+	}
+}
+
+func TestWithFieldOutsideLogHandlerIsNoop(t *testing.T) {
+	ctx := WithField(context.Background(), "key", "value")
+	if ctx == nil {
+		t.Fatal("WithField returned nil context")
+	}
+}
@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// defaultMaxLogSize is the size a rotating log file is allowed to reach
+// before Sink rolls it over to a timestamped backup.
+const defaultMaxLogSize = 100 << 20 // 100 MiB
+
+// Sink returns the io.Writer a Logger should write to: os.Stdout if path
+// is empty, otherwise a rotating file at path.
+func Sink(path string) (io.Writer, error) {
+	if path == "" {
+		return os.Stdout, nil
+	}
+	return newRotatingFile(path, defaultMaxLogSize)
+}
+
+// rotatingFile is an io.Writer over a log file that renames the current
+// file aside and starts a fresh one once it grows past maxSize, so a
+// long-running server's access log doesn't grow without bound.
+type rotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	f       *os.File
+	size    int64
+}
+
+func newRotatingFile(path string, maxSize int64) (*rotatingFile, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to stat log file: %w", err)
+	}
+	return &rotatingFile{path: path, maxSize: maxSize, f: f, size: info.Size()}, nil
+}
+
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.f.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+func (rf *rotatingFile) rotate() error {
+	if err := rf.f.Close(); err != nil {
+		return fmt.Errorf("failed to close log file for rotation: %w", err)
+	}
+
+	backup := fmt.Sprintf("%s.%s", rf.path, time.Now().UTC().Format("20060102T150405.000000000Z"))
+	if err := os.Rename(rf.path, backup); err != nil {
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+
+	f, err := os.OpenFile(rf.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file after rotation: %w", err)
+	}
+	rf.f = f
+	rf.size = 0
+	return nil
+}
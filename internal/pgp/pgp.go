@@ -0,0 +1,96 @@
+// Package pgp wraps the OpenPGP operations behind the /upload/pgp and
+// /download/pgp/{filename} endpoints: encrypting under a client-supplied
+// public key on the way in, and decrypting with a client-supplied private
+// key on the way out. It exists so files can be protected by a key the
+// server never stores, independent of the regular at-rest AES-256-GCM
+// layer in internal/storage: these files are stored via
+// storage.SaveEncryptedBlob, which does not apply that layer.
+package pgp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// Encrypt OpenPGP-encrypts plaintext for the recipient(s) in an armored
+// public key block, using AES-256 as the symmetric cipher. The returned
+// ciphertext is binary (not ASCII-armored), which is what
+// storage.SaveEncryptedBlob expects to persist verbatim.
+func Encrypt(plaintext io.Reader, armoredPublicKey string) ([]byte, error) {
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader([]byte(armoredPublicKey)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenPGP public key: %w", err)
+	}
+	if len(keyring) == 0 {
+		return nil, errors.New("no public key found in armored block")
+	}
+
+	var ciphertext bytes.Buffer
+	w, err := openpgp.Encrypt(&ciphertext, keyring, nil, nil, &packet.Config{
+		DefaultCipher: packet.CipherAES256,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start OpenPGP encryption: %w", err)
+	}
+	if _, err := io.Copy(w, plaintext); err != nil {
+		return nil, fmt.Errorf("failed to encrypt content: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finalize OpenPGP message: %w", err)
+	}
+	return ciphertext.Bytes(), nil
+}
+
+// Decrypt reverses Encrypt: it unlocks the armored private key with
+// passphrase (if the key is passphrase-protected; pass "" otherwise) and
+// decrypts ciphertext.
+func Decrypt(ciphertext []byte, armoredPrivateKey, passphrase string) ([]byte, error) {
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader([]byte(armoredPrivateKey)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenPGP private key: %w", err)
+	}
+	if len(keyring) == 0 {
+		return nil, errors.New("no private key found in armored block")
+	}
+
+	if passphrase != "" {
+		if err := unlockKeyring(keyring, []byte(passphrase)); err != nil {
+			return nil, err
+		}
+	}
+
+	md, err := openpgp.ReadMessage(bytes.NewReader(ciphertext), keyring, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt OpenPGP message: %w", err)
+	}
+	plaintext, err := io.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read decrypted content: %w", err)
+	}
+	return plaintext, nil
+}
+
+// unlockKeyring decrypts every passphrase-protected private key and
+// subkey in keyring in place, so ReadMessage can use them afterward.
+func unlockKeyring(keyring openpgp.EntityList, passphrase []byte) error {
+	for _, entity := range keyring {
+		if entity.PrivateKey != nil && entity.PrivateKey.Encrypted {
+			if err := entity.PrivateKey.Decrypt(passphrase); err != nil {
+				return fmt.Errorf("failed to decrypt private key: %w", err)
+			}
+		}
+		for _, subkey := range entity.Subkeys {
+			if subkey.PrivateKey != nil && subkey.PrivateKey.Encrypted {
+				if err := subkey.PrivateKey.Decrypt(passphrase); err != nil {
+					return fmt.Errorf("failed to decrypt private subkey: %w", err)
+				}
+			}
+		}
+	}
+	return nil
+}
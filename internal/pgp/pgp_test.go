@@ -0,0 +1,111 @@
+package pgp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// generateTestKeypair returns armored public and private key blocks for a
+// fresh OpenPGP entity, optionally passphrase-protecting the private key.
+func generateTestKeypair(t *testing.T, passphrase string) (publicKey, privateKey string) {
+	t.Helper()
+
+	entity, err := openpgp.NewEntity("Test User", "", "test@example.com", &packet.Config{
+		DefaultCipher: packet.CipherAES256,
+	})
+	if err != nil {
+		t.Fatalf("failed to generate test entity: %v", err)
+	}
+
+	var pubBuf bytes.Buffer
+	pubWriter, err := armor.Encode(&pubBuf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatalf("failed to create armor encoder: %v", err)
+	}
+	if err := entity.Serialize(pubWriter); err != nil {
+		t.Fatalf("failed to serialize public key: %v", err)
+	}
+	pubWriter.Close()
+
+	// SerializePrivate re-signs identities and subkey bindings with the
+	// private key material, which is no longer available once the key is
+	// passphrase encrypted (signing then panics), so the passphrase case
+	// below serializes with SerializePrivateWithoutSigning instead.
+	var privBuf bytes.Buffer
+	privWriter, err := armor.Encode(&privBuf, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		t.Fatalf("failed to create armor encoder: %v", err)
+	}
+
+	if passphrase != "" {
+		if err := entity.PrivateKey.Encrypt([]byte(passphrase)); err != nil {
+			t.Fatalf("failed to encrypt private key: %v", err)
+		}
+		for _, subkey := range entity.Subkeys {
+			if err := subkey.PrivateKey.Encrypt([]byte(passphrase)); err != nil {
+				t.Fatalf("failed to encrypt subkey: %v", err)
+			}
+		}
+		if err := entity.SerializePrivateWithoutSigning(privWriter, nil); err != nil {
+			t.Fatalf("failed to serialize private key: %v", err)
+		}
+	} else {
+		if err := entity.SerializePrivate(privWriter, nil); err != nil {
+			t.Fatalf("failed to serialize private key: %v", err)
+		}
+	}
+	privWriter.Close()
+
+	return pubBuf.String(), privBuf.String()
+}
+
+func TestEncryptAndDecryptRoundTrip(t *testing.T) {
+	publicKey, privateKey := generateTestKeypair(t, "")
+	plaintext := []byte("top secret payload")
+
+	ciphertext, err := Encrypt(bytes.NewReader(plaintext), publicKey)
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+
+	got, err := Decrypt(ciphertext, privateKey, "")
+	if err != nil {
+		t.Fatalf("Decrypt failed: %v", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("decrypted content = %q, want %q", got, plaintext)
+	}
+}
+
+func TestEncryptAndDecryptRoundTripWithPassphrase(t *testing.T) {
+	publicKey, privateKey := generateTestKeypair(t, "correct horse battery staple")
+	plaintext := []byte("payload behind a passphrase-protected key")
+
+	ciphertext, err := Encrypt(bytes.NewReader(plaintext), publicKey)
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+
+	if _, err := Decrypt(ciphertext, privateKey, "wrong passphrase"); err == nil {
+		t.Error("Decrypt succeeded with wrong passphrase, want error")
+	}
+
+	got, err := Decrypt(ciphertext, privateKey, "correct horse battery staple")
+	if err != nil {
+		t.Fatalf("Decrypt failed: %v", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("decrypted content = %q, want %q", got, plaintext)
+	}
+}
+
+func TestEncryptRejectsInvalidPublicKey(t *testing.T) {
+	if _, err := Encrypt(strings.NewReader("data"), "not a real key"); err == nil {
+		t.Error("Encrypt succeeded with an invalid public key, want error")
+	}
+}
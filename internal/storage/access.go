@@ -0,0 +1,466 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Access control manifests ("ACT", after Swarm's access-control tables)
+// let an uploader share a file with a set of X25519-keyed recipients
+// without re-encrypting the payload once per recipient. The payload is
+// encrypted once under a random per-file key; each recipient gets that
+// key wrapped under a key derived from an ECDH exchange with their public
+// key, and the wrapped keys travel in a JSON sidecar next to the
+// ciphertext.
+//
+// The server also keeps its own wrap of the file key (sealed under a key
+// derived from the service's STORAGE_KEY) so that GrantAccess/RevokeAccess
+// can be called again later without needing any recipient's private key.
+// This doesn't weaken the model: the server already holds STORAGE_KEY and
+// can decrypt any file via LoadFile regardless.
+
+const (
+	actManifestVersion = 1
+	actX25519KeySize   = 32
+)
+
+// ErrNotShared is returned by operations that require an existing
+// .act.json manifest when filename has never been shared.
+var ErrNotShared = errors.New("file is not shared")
+
+// grant is one recipient's wrapped copy of a shared file's key.
+type grant struct {
+	PubKey       []byte `json:"pub_key"`
+	PubKeyHash   []byte `json:"pub_key_hash"`
+	EphemeralPub []byte `json:"ephemeral_pub_key"`
+	Nonce        []byte `json:"nonce"`
+	WrappedKey   []byte `json:"wrapped_key"`
+}
+
+// shareManifest is the sidecar stored at <filename>.act.json.
+type shareManifest struct {
+	Version         int     `json:"version"`
+	OwnerNonce      []byte  `json:"owner_nonce"`
+	OwnerWrappedKey []byte  `json:"owner_wrapped_key"`
+	Grants          []grant `json:"grants"`
+}
+
+func sharedFileName(filename string) string {
+	return filename + ".shared.enc"
+}
+
+func manifestName(filename string) string {
+	return filename + ".act.json"
+}
+
+// lockFile acquires this Service's per-filename lock for filename,
+// returning a func to release it. GrantAccess and RevokeAccess hold it
+// across their whole loadManifest-then-saveManifest sequence, since that
+// sequence isn't atomic on its own: two concurrent calls sharing a
+// filename could otherwise both load the same manifest and save back
+// conflicting updates, silently losing whichever one saved first.
+func (s *Service) lockFile(filename string) func() {
+	muIface, _ := s.fileLocks.LoadOrStore(filename, &sync.Mutex{})
+	mu := muIface.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+// ownerKEK derives the key the server uses to wrap/unwrap a shared file's
+// key for its own bookkeeping, from the service's global encryption key.
+func (s *Service) ownerKEK() ([]byte, error) {
+	kdf := hkdf.New(sha256.New, s.key, nil, []byte("secure-storage/act-owner"))
+	kek := make([]byte, 32)
+	if _, err := io.ReadFull(kdf, kek); err != nil {
+		return nil, fmt.Errorf("failed to derive owner KEK: %w", err)
+	}
+	return kek, nil
+}
+
+func sealWithKey(key, plaintext []byte) (nonce, ciphertext []byte, err error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	nonce = make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return nonce, gcm.Seal(nil, nonce, plaintext, nil), nil
+}
+
+func openWithKey(key, nonce, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+// grantKEK derives the AES key used to wrap a file key for one recipient,
+// from the ECDH shared secret between an ephemeral keypair and the
+// recipient's (or the ephemeral's, from the recipient's side) public key.
+func grantKEK(sharedSecret, ephemeralPub, recipientPub []byte) ([]byte, error) {
+	salt := append(append([]byte(nil), ephemeralPub...), recipientPub...)
+	kdf := hkdf.New(sha256.New, sharedSecret, salt, []byte("secure-storage/act-grant"))
+	kek := make([]byte, 32)
+	if _, err := io.ReadFull(kdf, kek); err != nil {
+		return nil, fmt.Errorf("failed to derive grant KEK: %w", err)
+	}
+	return kek, nil
+}
+
+// loadManifest reads the sidecar manifest and unwraps the file key using
+// the server's own owner wrap.
+func (s *Service) loadManifest(filename string) (*shareManifest, []byte, error) {
+	r, err := s.backend.Get(manifestName(filename))
+	if err != nil {
+		if errors.Is(err, ErrObjectNotFound) {
+			return nil, nil, ErrNotShared
+		}
+		return nil, nil, fmt.Errorf("failed to read access manifest: %w", err)
+	}
+	defer r.Close()
+
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read access manifest: %w", err)
+	}
+
+	var manifest shareManifest
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse access manifest: %w", err)
+	}
+
+	kek, err := s.ownerKEK()
+	if err != nil {
+		return nil, nil, err
+	}
+	fileKey, err := openWithKey(kek, manifest.OwnerNonce, manifest.OwnerWrappedKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to unwrap file key: %w", err)
+	}
+
+	return &manifest, fileKey, nil
+}
+
+func (s *Service) saveManifest(filename string, manifest *shareManifest) error {
+	raw, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to encode access manifest: %w", err)
+	}
+	if err := s.backend.Put(manifestName(filename), bytes.NewReader(raw)); err != nil {
+		return fmt.Errorf("failed to write access manifest: %w", err)
+	}
+	return nil
+}
+
+// encryptSharedBlob re-encrypts plaintext under a freshly generated file
+// key, writing the ciphertext to the sidecar .shared.enc blob and sealing
+// the file key for the server's own bookkeeping.
+func (s *Service) encryptSharedBlob(filename string, plaintext []byte) (fileKey []byte, err error) {
+	fileKey = make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, fileKey); err != nil {
+		return nil, fmt.Errorf("failed to generate file key: %w", err)
+	}
+
+	nonce, ciphertext, err := sealWithKey(fileKey, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	body := append(nonce, ciphertext...)
+	if err := s.backend.Put(sharedFileName(filename), bytes.NewReader(body)); err != nil {
+		return nil, fmt.Errorf("failed to write shared blob: %w", err)
+	}
+
+	return fileKey, nil
+}
+
+// decryptSharedBlob reads and decrypts the .shared.enc blob with the
+// given (already-unwrapped) file key.
+func (s *Service) decryptSharedBlob(filename string, fileKey []byte) ([]byte, error) {
+	r, err := s.backend.Get(sharedFileName(filename))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read shared blob: %w", err)
+	}
+	defer r.Close()
+
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read shared blob: %w", err)
+	}
+
+	block, err := aes.NewCipher(fileKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	nonceSize := gcm.NonceSize()
+	if len(raw) < nonceSize {
+		return nil, errors.New("shared blob is too small")
+	}
+	return gcm.Open(nil, raw[:nonceSize], raw[nonceSize:], nil)
+}
+
+// GrantAccess shares filename with the recipient identified by pubKey (a
+// raw 32-byte X25519 public key), without re-encrypting the underlying
+// payload. The first call for a filename establishes the shared file key
+// from the file's existing plaintext; later calls just add another
+// wrapped copy of that same key.
+func (s *Service) GrantAccess(filename string, pubKey []byte) error {
+	if err := s.validateFilename(filename); err != nil {
+		return fmt.Errorf("invalid filename: %w", err)
+	}
+	if len(pubKey) != actX25519KeySize {
+		return fmt.Errorf("public key must be %d bytes", actX25519KeySize)
+	}
+	defer s.lockFile(filename)()
+
+	manifest, fileKey, err := s.loadManifest(filename)
+	if err != nil {
+		if !errors.Is(err, ErrNotShared) {
+			return err
+		}
+		plaintext, loadErr := s.LoadFile(filename)
+		if loadErr != nil {
+			return fmt.Errorf("failed to read file to share: %w", loadErr)
+		}
+		fileKey, err = s.encryptSharedBlob(filename, plaintext)
+		if err != nil {
+			return err
+		}
+		kek, err := s.ownerKEK()
+		if err != nil {
+			return err
+		}
+		ownerNonce, ownerWrapped, err := sealWithKey(kek, fileKey)
+		if err != nil {
+			return err
+		}
+		manifest = &shareManifest{
+			Version:         actManifestVersion,
+			OwnerNonce:      ownerNonce,
+			OwnerWrappedKey: ownerWrapped,
+		}
+	}
+
+	g, err := wrapFileKeyForRecipient(fileKey, pubKey)
+	if err != nil {
+		return err
+	}
+
+	// Re-granting an existing recipient just refreshes their wrapped key.
+	replaced := false
+	for i, existing := range manifest.Grants {
+		if bytes.Equal(existing.PubKeyHash, g.PubKeyHash) {
+			manifest.Grants[i] = g
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		manifest.Grants = append(manifest.Grants, g)
+	}
+
+	return s.saveManifest(filename, manifest)
+}
+
+// RevokeAccess removes a recipient's access to filename and rotates the
+// file key, re-wrapping it for every remaining grantee so the revoked
+// recipient's old wrapped key (and the key itself) can no longer decrypt
+// future reads.
+func (s *Service) RevokeAccess(filename string, pubKey []byte) error {
+	if err := s.validateFilename(filename); err != nil {
+		return fmt.Errorf("invalid filename: %w", err)
+	}
+	defer s.lockFile(filename)()
+
+	manifest, fileKey, err := s.loadManifest(filename)
+	if err != nil {
+		return err
+	}
+
+	pubKeyHash := sha256.Sum256(pubKey)
+	remaining := manifest.Grants[:0]
+	found := false
+	for _, g := range manifest.Grants {
+		if bytes.Equal(g.PubKeyHash, pubKeyHash[:]) {
+			found = true
+			continue
+		}
+		remaining = append(remaining, g)
+	}
+	if !found {
+		return errors.New("no such grant to revoke")
+	}
+
+	plaintext, err := s.decryptSharedBlob(filename, fileKey)
+	if err != nil {
+		return fmt.Errorf("failed to read shared file during revoke: %w", err)
+	}
+
+	newFileKey, err := s.encryptSharedBlob(filename, plaintext)
+	if err != nil {
+		return err
+	}
+
+	kek, err := s.ownerKEK()
+	if err != nil {
+		return err
+	}
+	ownerNonce, ownerWrapped, err := sealWithKey(kek, newFileKey)
+	if err != nil {
+		return err
+	}
+
+	newGrants := make([]grant, 0, len(remaining))
+	for _, g := range remaining {
+		rewrapped, err := wrapFileKeyForRecipient(newFileKey, g.PubKey)
+		if err != nil {
+			return err
+		}
+		newGrants = append(newGrants, rewrapped)
+	}
+
+	manifest.OwnerNonce = ownerNonce
+	manifest.OwnerWrappedKey = ownerWrapped
+	manifest.Grants = newGrants
+
+	return s.saveManifest(filename, manifest)
+}
+
+// wrapFileKeyForRecipient performs an ephemeral ECDH exchange with the
+// recipient's public key and seals fileKey under the resulting KEK.
+func wrapFileKeyForRecipient(fileKey, recipientPub []byte) (grant, error) {
+	curve := ecdh.X25519()
+	recipientKey, err := curve.NewPublicKey(recipientPub)
+	if err != nil {
+		return grant{}, fmt.Errorf("invalid recipient public key: %w", err)
+	}
+
+	ephemeral, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return grant{}, fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+
+	sharedSecret, err := ephemeral.ECDH(recipientKey)
+	if err != nil {
+		return grant{}, fmt.Errorf("ECDH exchange failed: %w", err)
+	}
+
+	ephemeralPub := ephemeral.PublicKey().Bytes()
+	kek, err := grantKEK(sharedSecret, ephemeralPub, recipientPub)
+	if err != nil {
+		return grant{}, err
+	}
+
+	nonce, wrapped, err := sealWithKey(kek, fileKey)
+	if err != nil {
+		return grant{}, err
+	}
+
+	pubKeyHash := sha256.Sum256(recipientPub)
+	return grant{
+		PubKey:       append([]byte(nil), recipientPub...),
+		PubKeyHash:   pubKeyHash[:],
+		EphemeralPub: ephemeralPub,
+		Nonce:        nonce,
+		WrappedKey:   wrapped,
+	}, nil
+}
+
+// LoadFileAs decrypts a shared file as the recipient holding privKey (a
+// raw 32-byte X25519 private key), unwrapping the file key via ECDH
+// rather than the server's STORAGE_KEY.
+func (s *Service) LoadFileAs(filename string, privKey []byte) ([]byte, error) {
+	if err := s.validateFilename(filename); err != nil {
+		return nil, fmt.Errorf("invalid filename: %w", err)
+	}
+	if len(privKey) != actX25519KeySize {
+		return nil, fmt.Errorf("private key must be %d bytes", actX25519KeySize)
+	}
+
+	r, err := s.backend.Get(manifestName(filename))
+	if err != nil {
+		if errors.Is(err, ErrObjectNotFound) {
+			return nil, ErrNotShared
+		}
+		return nil, fmt.Errorf("failed to read access manifest: %w", err)
+	}
+	defer r.Close()
+
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read access manifest: %w", err)
+	}
+	var manifest shareManifest
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse access manifest: %w", err)
+	}
+
+	curve := ecdh.X25519()
+	recipientKey, err := curve.NewPrivateKey(privKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	recipientPub := recipientKey.PublicKey().Bytes()
+	pubKeyHash := sha256.Sum256(recipientPub)
+
+	var g *grant
+	for i := range manifest.Grants {
+		if bytes.Equal(manifest.Grants[i].PubKeyHash, pubKeyHash[:]) {
+			g = &manifest.Grants[i]
+			break
+		}
+	}
+	if g == nil {
+		return nil, errors.New("access denied: no grant for this key")
+	}
+
+	ephemeralPub, err := curve.NewPublicKey(g.EphemeralPub)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ephemeral public key in manifest: %w", err)
+	}
+	sharedSecret, err := recipientKey.ECDH(ephemeralPub)
+	if err != nil {
+		return nil, fmt.Errorf("ECDH exchange failed: %w", err)
+	}
+
+	kek, err := grantKEK(sharedSecret, g.EphemeralPub, recipientPub)
+	if err != nil {
+		return nil, err
+	}
+
+	fileKey, err := openWithKey(kek, g.Nonce, g.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap file key: %w", err)
+	}
+
+	plaintext, err := s.decryptSharedBlob(filename, fileKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt shared file: %w", err)
+	}
+	return plaintext, nil
+}
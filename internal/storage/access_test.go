@@ -0,0 +1,233 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestConcurrentGrantAccessKeepsEveryGrant(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "storage_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	svc, err := NewService("12345678901234567890123456789012", tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+
+	filename := "shared.txt"
+	if err := svc.SaveFile(filename, bytes.NewReader([]byte("shared secret content"))); err != nil {
+		t.Fatalf("SaveFile failed: %v", err)
+	}
+
+	const n = 10
+	pubs := make([][]byte, n)
+	for i := range pubs {
+		_, pub := generateX25519Keypair(t)
+		pubs[i] = pub
+	}
+
+	errs := make(chan error, n)
+	for _, pub := range pubs {
+		pub := pub
+		go func() { errs <- svc.GrantAccess(filename, pub) }()
+	}
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("GrantAccess failed: %v", err)
+		}
+	}
+
+	manifest, _, err := svc.loadManifest(filename)
+	if err != nil {
+		t.Fatalf("loadManifest failed: %v", err)
+	}
+	if len(manifest.Grants) != n {
+		t.Errorf("manifest has %d grants after %d concurrent GrantAccess calls, want %d", len(manifest.Grants), n, n)
+	}
+}
+
+func generateX25519Keypair(t *testing.T) (priv, pub []byte) {
+	t.Helper()
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate X25519 key: %v", err)
+	}
+	return key.Bytes(), key.PublicKey().Bytes()
+}
+
+func TestGrantAndLoadFileAs(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "storage_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	svc, err := NewService("12345678901234567890123456789012", tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+
+	filename := "shared.txt"
+	testData := []byte("shared secret content")
+	if err := svc.SaveFile(filename, bytes.NewReader(testData)); err != nil {
+		t.Fatalf("SaveFile failed: %v", err)
+	}
+
+	priv, pub := generateX25519Keypair(t)
+	if err := svc.GrantAccess(filename, pub); err != nil {
+		t.Fatalf("GrantAccess failed: %v", err)
+	}
+
+	loaded, err := svc.LoadFileAs(filename, priv)
+	if err != nil {
+		t.Fatalf("LoadFileAs failed: %v", err)
+	}
+	if !bytes.Equal(loaded, testData) {
+		t.Errorf("loaded data does not match original.\nGot: %s\nWant: %s", loaded, testData)
+	}
+}
+
+func TestLoadFileAsUngrantedKeyFails(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "storage_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	svc, err := NewService("12345678901234567890123456789012", tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+
+	filename := "shared.txt"
+	if err := svc.SaveFile(filename, bytes.NewReader([]byte("data"))); err != nil {
+		t.Fatalf("SaveFile failed: %v", err)
+	}
+
+	grantedPriv, grantedPub := generateX25519Keypair(t)
+	strangerPriv, _ := generateX25519Keypair(t)
+
+	if err := svc.GrantAccess(filename, grantedPub); err != nil {
+		t.Fatalf("GrantAccess failed: %v", err)
+	}
+
+	if _, err := svc.LoadFileAs(filename, strangerPriv); err == nil {
+		t.Error("expected error loading file as an ungranted key, got nil")
+	}
+
+	// Sanity check the granted key still works.
+	if _, err := svc.LoadFileAs(filename, grantedPriv); err != nil {
+		t.Errorf("expected granted key to load file, got error: %v", err)
+	}
+}
+
+func TestRevokeAccessRemovesGrantAndRotatesKey(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "storage_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	svc, err := NewService("12345678901234567890123456789012", tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+
+	filename := "shared.txt"
+	testData := []byte("shared secret content")
+	if err := svc.SaveFile(filename, bytes.NewReader(testData)); err != nil {
+		t.Fatalf("SaveFile failed: %v", err)
+	}
+
+	revokedPriv, revokedPub := generateX25519Keypair(t)
+	keptPriv, keptPub := generateX25519Keypair(t)
+
+	if err := svc.GrantAccess(filename, revokedPub); err != nil {
+		t.Fatalf("GrantAccess (revoked) failed: %v", err)
+	}
+	if err := svc.GrantAccess(filename, keptPub); err != nil {
+		t.Fatalf("GrantAccess (kept) failed: %v", err)
+	}
+
+	if err := svc.RevokeAccess(filename, revokedPub); err != nil {
+		t.Fatalf("RevokeAccess failed: %v", err)
+	}
+
+	if _, err := svc.LoadFileAs(filename, revokedPriv); err == nil {
+		t.Error("expected revoked key to lose access, got nil error")
+	}
+
+	loaded, err := svc.LoadFileAs(filename, keptPriv)
+	if err != nil {
+		t.Fatalf("expected remaining grantee to still have access: %v", err)
+	}
+	if !bytes.Equal(loaded, testData) {
+		t.Error("remaining grantee's decrypted data does not match original after revoke")
+	}
+}
+
+func TestRevokeUngrantedKeyFails(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "storage_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	svc, err := NewService("12345678901234567890123456789012", tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+
+	filename := "shared.txt"
+	if err := svc.SaveFile(filename, bytes.NewReader([]byte("data"))); err != nil {
+		t.Fatalf("SaveFile failed: %v", err)
+	}
+
+	_, pub := generateX25519Keypair(t)
+	if err := svc.RevokeAccess(filename, pub); err == nil {
+		t.Error("expected error revoking a key that was never granted")
+	}
+}
+
+func TestGrantAccessRequiresExistingManifestOrFile(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "storage_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	svc, err := NewService("12345678901234567890123456789012", tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+
+	_, pub := generateX25519Keypair(t)
+	if err := svc.GrantAccess("nonexistent.txt", pub); err == nil {
+		t.Error("expected error sharing a file that was never uploaded")
+	}
+}
+
+func TestErrNotSharedSentinel(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "storage_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	svc, err := NewService("12345678901234567890123456789012", tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+
+	_, _, err = svc.loadManifest("never-shared.txt")
+	if !errors.Is(err, ErrNotShared) {
+		t.Errorf("expected ErrNotShared, got %v", err)
+	}
+}
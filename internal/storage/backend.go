@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ErrObjectNotFound is returned by a Backend when the named object does
+// not exist.
+var ErrObjectNotFound = errors.New("object not found")
+
+// Backend is the storage abstraction Service encrypts on top of. All
+// encryption, authentication, and key management happens in Service
+// before bytes ever reach a Backend, so a Backend only ever sees
+// ciphertext, sidecar manifests, and checksums — never plaintext or key
+// material.
+type Backend interface {
+	// Put stores the contents of r under name, replacing any existing
+	// object with that name.
+	Put(name string, r io.Reader) error
+
+	// Get opens the object stored under name for reading. The caller must
+	// close the returned ReadCloser. Returns ErrObjectNotFound if name
+	// does not exist.
+	Get(name string) (io.ReadCloser, error)
+
+	// Stat returns the size in bytes of the object stored under name.
+	// Returns ErrObjectNotFound if name does not exist.
+	Stat(name string) (int64, error)
+
+	// Delete removes the object stored under name. Returns
+	// ErrObjectNotFound if name does not exist.
+	Delete(name string) error
+
+	// List returns the names of every object currently stored.
+	List() ([]string, error)
+}
+
+// LocalBackend stores objects as files in a directory on local disk. This
+// is the original behavior of Service before Backend was introduced.
+type LocalBackend struct {
+	dir string
+}
+
+// NewLocalBackend creates a LocalBackend rooted at dir. The directory is
+// not created here; callers are expected to have already ensured it
+// exists (as main does today via os.MkdirAll).
+func NewLocalBackend(dir string) *LocalBackend {
+	return &LocalBackend{dir: dir}
+}
+
+func (b *LocalBackend) path(name string) string {
+	return filepath.Join(b.dir, name)
+}
+
+func (b *LocalBackend) Put(name string, r io.Reader) error {
+	path := b.path(name)
+	if dir := filepath.Dir(path); dir != b.dir {
+		// Object names may contain slashes (e.g. the dedup store's
+		// "blobs/<hash>.enc"), so make sure the parent directory exists.
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (b *LocalBackend) Get(name string) (io.ReadCloser, error) {
+	f, err := os.Open(b.path(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+func (b *LocalBackend) Stat(name string) (int64, error) {
+	info, err := os.Stat(b.path(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, ErrObjectNotFound
+		}
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (b *LocalBackend) Delete(name string) error {
+	err := os.Remove(b.path(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrObjectNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (b *LocalBackend) List() ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(b.dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(b.dir, path)
+		if err != nil {
+			return err
+		}
+		// Object names may contain slashes (e.g. the dedup store's
+		// "blobs/<hash>.enc"), so always report them with forward
+		// slashes regardless of platform, matching how they were passed
+		// to Put.
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+)
+
+// AzureBlobBackend stores objects as blobs in a single Azure Storage
+// container, optionally under a blob name prefix.
+type AzureBlobBackend struct {
+	client    *azblob.Client
+	container string
+	prefix    string
+}
+
+// NewAzureBlobBackend creates a Backend backed by an Azure Storage
+// container, authenticating with a storage account connection string.
+func NewAzureBlobBackend(connectionString, container, prefix string) (*AzureBlobBackend, error) {
+	if container == "" {
+		return nil, errors.New("Azure container is required")
+	}
+
+	client, err := azblob.NewClientFromConnectionString(connectionString, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Azure Blob client: %w", err)
+	}
+
+	return &AzureBlobBackend{
+		client:    client,
+		container: container,
+		prefix:    prefix,
+	}, nil
+}
+
+func (b *AzureBlobBackend) blobName(name string) string {
+	if b.prefix == "" {
+		return name
+	}
+	return b.prefix + "/" + name
+}
+
+func (b *AzureBlobBackend) Put(name string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read blob body: %w", err)
+	}
+
+	_, err = b.client.UploadBuffer(context.Background(), b.container, b.blobName(name), data, nil)
+	if err != nil {
+		return fmt.Errorf("Azure UploadBuffer failed: %w", err)
+	}
+	return nil
+}
+
+func (b *AzureBlobBackend) Get(name string) (io.ReadCloser, error) {
+	resp, err := b.client.DownloadStream(context.Background(), b.container, b.blobName(name), nil)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, fmt.Errorf("Azure DownloadStream failed: %w", err)
+	}
+	return resp.Body, nil
+}
+
+func (b *AzureBlobBackend) Stat(name string) (int64, error) {
+	client := b.client.ServiceClient().NewContainerClient(b.container).NewBlobClient(b.blobName(name))
+	props, err := client.GetProperties(context.Background(), nil)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return 0, ErrObjectNotFound
+		}
+		return 0, fmt.Errorf("Azure GetProperties failed: %w", err)
+	}
+	if props.ContentLength == nil {
+		return 0, nil
+	}
+	return *props.ContentLength, nil
+}
+
+func (b *AzureBlobBackend) Delete(name string) error {
+	_, err := b.client.DeleteBlob(context.Background(), b.container, b.blobName(name), nil)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return ErrObjectNotFound
+		}
+		return fmt.Errorf("Azure DeleteBlob failed: %w", err)
+	}
+	return nil
+}
+
+func (b *AzureBlobBackend) List() ([]string, error) {
+	var names []string
+	pager := b.client.NewListBlobsFlatPager(b.container, &azblob.ListBlobsFlatOptions{
+		Prefix: to.Ptr(b.prefix),
+	})
+	for pager.More() {
+		page, err := pager.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("Azure ListBlobsFlat failed: %w", err)
+		}
+		for _, item := range page.Segment.BlobItems {
+			if item.Name == nil {
+				continue
+			}
+			names = append(names, trimBlobPrefix(*item.Name, b.prefix))
+		}
+	}
+	return names, nil
+}
+
+func trimBlobPrefix(name, prefix string) string {
+	if prefix == "" {
+		return name
+	}
+	trimmed := prefix + "/"
+	if len(name) > len(trimmed) && name[:len(trimmed)] == trimmed {
+		return name[len(trimmed):]
+	}
+	return name
+}
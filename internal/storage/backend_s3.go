@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// S3Backend stores objects in an S3-compatible bucket under an optional
+// key prefix. Setting Endpoint lets this point at a MinIO (or any other
+// S3-compatible) server instead of AWS.
+type S3Backend struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+// S3BackendConfig configures NewS3Backend.
+type S3BackendConfig struct {
+	Bucket string
+	Prefix string
+	// Endpoint, when set, overrides the default AWS endpoint resolution.
+	// Use this to point at a MinIO (or other S3-compatible) server.
+	Endpoint string
+	// Region is required by the AWS SDK even against non-AWS endpoints.
+	Region string
+	// UsePathStyle is required by most non-AWS S3-compatible servers
+	// (e.g. MinIO), which don't support virtual-hosted-style addressing.
+	UsePathStyle bool
+}
+
+// NewS3Backend creates a Backend backed by an S3 (or S3-compatible)
+// bucket, loading credentials from the standard AWS environment
+// variables/config files/instance role chain.
+func NewS3Backend(ctx context.Context, cfg S3BackendConfig) (*S3Backend, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("S3 bucket is required")
+	}
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(cfg.Region))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+		o.UsePathStyle = cfg.UsePathStyle
+	})
+
+	return &S3Backend{
+		client: client,
+		bucket: cfg.Bucket,
+		prefix: cfg.Prefix,
+	}, nil
+}
+
+func (b *S3Backend) key(name string) string {
+	if b.prefix == "" {
+		return name
+	}
+	return strings.TrimSuffix(b.prefix, "/") + "/" + name
+}
+
+func (b *S3Backend) Put(name string, r io.Reader) error {
+	// The SDK's PutObject needs a ReadSeeker for retries/checksums, so
+	// buffer the (already-encrypted) body rather than streaming it
+	// directly; objects here are individual files, not unbounded streams.
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read object body: %w", err)
+	}
+
+	_, err = b.client.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(b.key(name)),
+		Body:   bytes.NewReader(data),
+	})
+	if err != nil {
+		return fmt.Errorf("S3 PutObject failed: %w", err)
+	}
+	return nil
+}
+
+func (b *S3Backend) Get(name string) (io.ReadCloser, error) {
+	out, err := b.client.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(b.key(name)),
+	})
+	if err != nil {
+		if isS3NotFound(err) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, fmt.Errorf("S3 GetObject failed: %w", err)
+	}
+	return out.Body, nil
+}
+
+func (b *S3Backend) Stat(name string) (int64, error) {
+	out, err := b.client.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(b.key(name)),
+	})
+	if err != nil {
+		if isS3NotFound(err) {
+			return 0, ErrObjectNotFound
+		}
+		return 0, fmt.Errorf("S3 HeadObject failed: %w", err)
+	}
+	if out.ContentLength == nil {
+		return 0, nil
+	}
+	return *out.ContentLength, nil
+}
+
+func (b *S3Backend) Delete(name string) error {
+	// DeleteObject succeeds for a missing key, so check existence first to
+	// report ErrObjectNotFound as Backend.Delete documents.
+	if _, err := b.Stat(name); err != nil {
+		return err
+	}
+
+	_, err := b.client.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(b.key(name)),
+	})
+	if err != nil {
+		if isS3NotFound(err) {
+			return ErrObjectNotFound
+		}
+		return fmt.Errorf("S3 DeleteObject failed: %w", err)
+	}
+	return nil
+}
+
+func (b *S3Backend) List() ([]string, error) {
+	keyPrefix := ""
+	if b.prefix != "" {
+		keyPrefix = strings.TrimSuffix(b.prefix, "/") + "/"
+	}
+
+	var names []string
+	paginator := s3.NewListObjectsV2Paginator(b.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(b.bucket),
+		Prefix: aws.String(keyPrefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("S3 ListObjectsV2 failed: %w", err)
+		}
+		for _, obj := range page.Contents {
+			if obj.Key == nil {
+				continue
+			}
+			names = append(names, strings.TrimPrefix(*obj.Key, keyPrefix))
+		}
+	}
+	return names, nil
+}
+
+// isS3NotFound reports whether err is the S3 "no such key"/404 error.
+func isS3NotFound(err error) bool {
+	var respErr *smithyhttp.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.HTTPStatusCode() == 404
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+// TestS3BackendAgainstMinIO exercises S3Backend against a real
+// S3-compatible server. It is skipped unless MINIO_ENDPOINT (and a bucket
+// to use) are configured, since no MinIO container is available by
+// default in CI/dev sandboxes.
+func TestS3BackendAgainstMinIO(t *testing.T) {
+	endpoint := os.Getenv("MINIO_ENDPOINT")
+	bucket := os.Getenv("MINIO_BUCKET")
+	if endpoint == "" || bucket == "" {
+		t.Skip("MINIO_ENDPOINT/MINIO_BUCKET not set, skipping MinIO integration test")
+	}
+
+	backend, err := NewS3Backend(context.Background(), S3BackendConfig{
+		Bucket:       bucket,
+		Prefix:       "backend-integration-test",
+		Endpoint:     endpoint,
+		Region:       envOrDefault("MINIO_REGION", "us-east-1"),
+		UsePathStyle: true,
+	})
+	if err != nil {
+		t.Fatalf("NewS3Backend failed: %v", err)
+	}
+
+	const name = "roundtrip.bin"
+	want := []byte("minio integration test payload")
+
+	if err := backend.Put(name, bytes.NewReader(want)); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	defer backend.Delete(name)
+
+	size, err := backend.Stat(name)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if size != int64(len(want)) {
+		t.Errorf("Stat size = %d, want %d", size, len(want))
+	}
+
+	rc, err := backend.Get(name)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	got, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatalf("reading object failed: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Get contents = %q, want %q", got, want)
+	}
+
+	if err := backend.Delete(name); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := backend.Get(name); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("expected ErrObjectNotFound after delete, got %v", err)
+	}
+}
+
+func envOrDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestLocalBackendPutGetDeleteList(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "backend_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	b := NewLocalBackend(tmpDir)
+
+	if err := b.Put("object.bin", bytes.NewReader([]byte("hello world"))); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	size, err := b.Stat("object.bin")
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if size != int64(len("hello world")) {
+		t.Errorf("Stat size = %d, want %d", size, len("hello world"))
+	}
+
+	rc, err := b.Get("object.bin")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatalf("reading object failed: %v", err)
+	}
+	if string(data) != "hello world" {
+		t.Errorf("Get contents = %q, want %q", data, "hello world")
+	}
+
+	names, err := b.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(names) != 1 || names[0] != "object.bin" {
+		t.Errorf("List = %v, want [object.bin]", names)
+	}
+
+	if err := b.Delete("object.bin"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := b.Stat("object.bin"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("expected ErrObjectNotFound after delete, got %v", err)
+	}
+}
+
+func TestLocalBackendListIncludesNestedObjects(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "backend_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	b := NewLocalBackend(tmpDir)
+
+	if err := b.Put("object.bin", bytes.NewReader([]byte("hello world"))); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := b.Put("blobs/deadbeef.enc", bytes.NewReader([]byte("chunk"))); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	names, err := b.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+
+	want := map[string]bool{"object.bin": true, "blobs/deadbeef.enc": true}
+	if len(names) != len(want) {
+		t.Fatalf("List = %v, want keys %v", names, want)
+	}
+	for _, name := range names {
+		if !want[name] {
+			t.Errorf("List returned unexpected name %q", name)
+		}
+	}
+}
+
+func TestLocalBackendGetMissingObject(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "backend_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	b := NewLocalBackend(tmpDir)
+	if _, err := b.Get("missing.bin"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("expected ErrObjectNotFound, got %v", err)
+	}
+	if err := b.Delete("missing.bin"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("expected ErrObjectNotFound on delete, got %v", err)
+	}
+}
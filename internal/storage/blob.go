@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+func blobObjectName(name string) string {
+	return name + ".pgp"
+}
+
+func blobChecksumName(name string) string {
+	return name + ".pgp.sha256"
+}
+
+// SaveEncryptedBlob persists ciphertext under name verbatim, with no GCM
+// framing, alongside a SHA-256 checksum sidecar. It exists for payloads
+// that are already encrypted under a key Service never had in the first
+// place -- e.g. an OpenPGP message encrypted for a client-supplied
+// recipient key (see the /upload/pgp handler) -- so that layer of
+// encryption survives even a compromised STORAGE_KEY. The checksum is
+// only there to catch accidental corruption: whatever produced
+// ciphertext is responsible for its own tamper detection.
+func (s *Service) SaveEncryptedBlob(name string, ciphertext io.Reader) error {
+	if err := s.validateFilename(name); err != nil {
+		return fmt.Errorf("invalid filename: %w", err)
+	}
+
+	data, err := io.ReadAll(ciphertext)
+	if err != nil {
+		return fmt.Errorf("failed to read blob: %w", err)
+	}
+
+	if err := s.backend.Put(blobObjectName(name), bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to write blob: %w", err)
+	}
+
+	checksum := sha256.Sum256(data)
+	if err := s.backend.Put(blobChecksumName(name), strings.NewReader(hex.EncodeToString(checksum[:]))); err != nil {
+		return fmt.Errorf("failed to write blob checksum: %w", err)
+	}
+	return nil
+}
+
+// LoadEncryptedBlob reads back a blob stored by SaveEncryptedBlob and
+// verifies it against its checksum sidecar.
+func (s *Service) LoadEncryptedBlob(name string) ([]byte, error) {
+	if err := s.validateFilename(name); err != nil {
+		return nil, fmt.Errorf("invalid filename: %w", err)
+	}
+
+	r, err := s.backend.Get(blobObjectName(name))
+	if err != nil {
+		if errors.Is(err, ErrObjectNotFound) {
+			return nil, errors.New("file not found")
+		}
+		return nil, fmt.Errorf("failed to read blob: %w", err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob: %w", err)
+	}
+
+	checksumR, err := s.backend.Get(blobChecksumName(name))
+	if err != nil {
+		if errors.Is(err, ErrObjectNotFound) {
+			return nil, errors.New("file not found")
+		}
+		return nil, fmt.Errorf("failed to read blob checksum: %w", err)
+	}
+	defer checksumR.Close()
+	wantHex, err := io.ReadAll(checksumR)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob checksum: %w", err)
+	}
+
+	got := sha256.Sum256(data)
+	if hex.EncodeToString(got[:]) != strings.TrimSpace(string(wantHex)) {
+		return nil, errors.New("blob failed checksum verification")
+	}
+	return data, nil
+}
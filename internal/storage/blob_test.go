@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestSaveAndLoadEncryptedBlob(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "blob_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	svc, err := NewService("12345678901234567890123456789012", tmpDir)
+	if err != nil {
+		t.Fatalf("NewService failed: %v", err)
+	}
+
+	ciphertext := []byte("opaque bytes from some other encryption scheme")
+	if err := svc.SaveEncryptedBlob("message.pgp.bin", bytes.NewReader(ciphertext)); err != nil {
+		t.Fatalf("SaveEncryptedBlob failed: %v", err)
+	}
+
+	got, err := svc.LoadEncryptedBlob("message.pgp.bin")
+	if err != nil {
+		t.Fatalf("LoadEncryptedBlob failed: %v", err)
+	}
+	if !bytes.Equal(got, ciphertext) {
+		t.Errorf("loaded blob = %q, want %q", got, ciphertext)
+	}
+}
+
+func TestLoadEncryptedBlobDetectsCorruption(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "blob_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	svc, err := NewService("12345678901234567890123456789012", tmpDir)
+	if err != nil {
+		t.Fatalf("NewService failed: %v", err)
+	}
+
+	if err := svc.SaveEncryptedBlob("message.pgp.bin", bytes.NewReader([]byte("original bytes"))); err != nil {
+		t.Fatalf("SaveEncryptedBlob failed: %v", err)
+	}
+	if err := svc.backend.Put(blobObjectName("message.pgp.bin"), bytes.NewReader([]byte("tampered!!!!!!"))); err != nil {
+		t.Fatalf("failed to tamper with blob: %v", err)
+	}
+
+	if _, err := svc.LoadEncryptedBlob("message.pgp.bin"); err == nil {
+		t.Error("LoadEncryptedBlob succeeded on tampered data, want error")
+	}
+}
+
+func TestLoadEncryptedBlobMissing(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "blob_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	svc, err := NewService("12345678901234567890123456789012", tmpDir)
+	if err != nil {
+		t.Fatalf("NewService failed: %v", err)
+	}
+
+	if _, err := svc.LoadEncryptedBlob("missing.pgp.bin"); err == nil {
+		t.Error("LoadEncryptedBlob succeeded for a missing blob, want error")
+	}
+}
@@ -0,0 +1,537 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Content-addressed, deduplicating storage.
+//
+// When a Service is constructed with NewServiceWithDedup, SaveFile splits
+// the plaintext into content-defined chunks using a rolling hash (a gear
+// hash, the same family as Rabin fingerprinting used by tools like
+// restic/rsync): a boundary falls wherever the rolling hash of the last
+// few bytes is "locally distinctive" rather than at fixed offsets, so
+// inserting or editing bytes anywhere in a file only perturbs the chunks
+// next to the edit, not every chunk after it. Each chunk is encrypted
+// under a key derived purely from the chunk's own plaintext SHA-256
+// (convergent encryption) and stored once under blobs/<sha256>.enc,
+// regardless of how many filenames (or uploaders sharing this backend)
+// contain that exact chunk. A filename maps to a small encrypted manifest
+// listing its chunk hashes, sizes, total length, and whole-file SHA-256;
+// a refcount sidecar per blob lets DeleteFile garbage-collect chunks
+// nothing references any more.
+//
+// Convergent encryption has a well-known caveat: because a chunk's key is
+// derived only from its own plaintext, anyone who can guess a chunk's
+// contents can derive its key and check whether that exact chunk is
+// already stored (a "confirmation of file" attack) -- e.g. probing
+// whether a particular known document is present. Dedup is therefore
+// opt-in via NewServiceWithDedup rather than the default behavior of
+// NewServiceWithBackend.
+
+const (
+	dedupManifestVersion = 1
+
+	// Chunk boundaries are content-defined (see chunkStream) and aim for
+	// this average size, but are never smaller than dedupMinChunkSize
+	// (except a final short chunk) or larger than dedupMaxChunkSize.
+	dedupAvgChunkSize = 1 << 20   // 1 MiB
+	dedupMinChunkSize = 512 << 10 // 512 KiB
+	dedupMaxChunkSize = 4 << 20   // 4 MiB
+
+	// dedupBoundaryMaskBits is log2(dedupAvgChunkSize - dedupMinChunkSize):
+	// a boundary is declared wherever that many low bits of the rolling
+	// hash are zero, which happens on average once every 512 KiB. Since
+	// boundaries are only looked for past dedupMinChunkSize, chunks average
+	// about dedupMinChunkSize + 512 KiB = dedupAvgChunkSize.
+	dedupBoundaryMaskBits = 19
+)
+
+var dedupBoundaryMask = uint64(1)<<dedupBoundaryMaskBits - 1
+
+// gearTable holds the pseudo-random 64-bit constants the rolling hash
+// mixes in per byte. It's generated deterministically (splitmix64) rather
+// than embedded as a literal so it's identical across builds and
+// platforms without a few KiB of magic numbers in the source.
+var gearTable = func() [256]uint64 {
+	var t [256]uint64
+	seed := uint64(0x9e3779b97f4a7c15)
+	for i := range t {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		z ^= z >> 31
+		t[i] = z
+	}
+	return t
+}()
+
+// chunkStream splits content into content-defined chunks, invoking yield
+// with each chunk's plaintext in order. yield's slice is only valid for
+// the duration of the call.
+func chunkStream(content io.Reader, yield func(chunk []byte) error) error {
+	br := bufio.NewReaderSize(content, 64*1024)
+	buf := make([]byte, 0, dedupMaxChunkSize)
+	var hash uint64
+
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read file content: %w", err)
+		}
+
+		buf = append(buf, b)
+		hash = (hash << 1) + gearTable[b]
+
+		atBoundary := len(buf) >= dedupMinChunkSize && hash&dedupBoundaryMask == 0
+		if atBoundary || len(buf) >= dedupMaxChunkSize {
+			if err := yield(buf); err != nil {
+				return err
+			}
+			buf = make([]byte, 0, dedupMaxChunkSize)
+			hash = 0
+		}
+	}
+
+	if len(buf) > 0 {
+		if err := yield(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chunkRef is one chunk of a dedup-mode file's manifest.
+type chunkRef struct {
+	Hash string `json:"hash"`
+	Size uint32 `json:"size"`
+}
+
+// dedupManifest is the JSON document sealed into <filename>.dedup.json.
+type dedupManifest struct {
+	Version     int        `json:"version"`
+	TotalLen    uint64     `json:"total_len"`
+	PlainSHA256 string     `json:"plain_sha256"`
+	Chunks      []chunkRef `json:"chunks"`
+}
+
+func dedupManifestName(filename string) string {
+	return filename + ".dedup.json"
+}
+
+func blobName(hashHex string) string {
+	return "blobs/" + hashHex + ".enc"
+}
+
+func blobRefcountName(hashHex string) string {
+	return "blobs/" + hashHex + ".refcount"
+}
+
+// dedupManifestKey derives the key used to seal a file's dedup manifest
+// from the service's global encryption key. The manifest doesn't hold
+// plaintext, but it is still worth keeping confidential: it reveals a
+// file's size and, via shared chunk hashes, which other files overlap
+// with it.
+func (s *Service) dedupManifestKey() ([]byte, error) {
+	kdf := hkdf.New(sha256.New, s.key, nil, []byte("secure-storage/dedup-manifest"))
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(kdf, key); err != nil {
+		return nil, fmt.Errorf("failed to derive manifest key: %w", err)
+	}
+	return key, nil
+}
+
+// chunkKey derives a chunk's convergent encryption key from its plaintext
+// SHA-256. Deriving purely from content, with no input from s.key, is
+// what lets identical chunks from different files -- or different
+// uploaders sharing this backend -- dedupe to the same blob.
+func chunkKey(chunkHash []byte) ([]byte, error) {
+	kdf := hkdf.New(sha256.New, chunkHash, nil, []byte("secure-storage/dedup-chunk"))
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(kdf, key); err != nil {
+		return nil, fmt.Errorf("failed to derive chunk key: %w", err)
+	}
+	return key, nil
+}
+
+// chunkNonce is fixed rather than random. Convergent encryption requires
+// that encrypting the same plaintext chunk always produce the same
+// ciphertext (so it dedupes by content), and since chunkKey is unique to
+// this chunk's own plaintext, reusing one all-zero nonce under that key
+// never leaks anything a nonce would otherwise protect between two
+// *different* chunks -- their keys differ.
+var chunkNonce = make([]byte, 12)
+
+// encryptChunk seals chunk under its own convergent key, returning the
+// chunk's content hash alongside the ciphertext.
+func encryptChunk(chunk []byte) (hash [32]byte, ciphertext []byte, err error) {
+	hash = sha256.Sum256(chunk)
+	key, err := chunkKey(hash[:])
+	if err != nil {
+		return hash, nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return hash, nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return hash, nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return hash, gcm.Seal(nil, chunkNonce, chunk, nil), nil
+}
+
+// decryptChunk opens a chunk sealed by encryptChunk and re-verifies its
+// content hash, so a blob swapped in under the wrong name is caught even
+// though it would otherwise decrypt cleanly under its own key.
+func decryptChunk(hashHex string, ciphertext []byte) ([]byte, error) {
+	hash, err := hex.DecodeString(hashHex)
+	if err != nil {
+		return nil, fmt.Errorf("corrupt chunk hash %q: %w", hashHex, err)
+	}
+	key, err := chunkKey(hash)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	plaintext, err := gcm.Open(nil, chunkNonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt chunk %s: %w", hashHex, err)
+	}
+	actual := sha256.Sum256(plaintext)
+	if hex.EncodeToString(actual[:]) != hashHex {
+		return nil, fmt.Errorf("chunk %s failed content hash verification", hashHex)
+	}
+	return plaintext, nil
+}
+
+// readRefcount returns the number of manifests currently referencing the
+// blob identified by hashHex. Returns ErrObjectNotFound if the blob has no
+// refcount sidecar (i.e. doesn't exist).
+func (s *Service) readRefcount(hashHex string) (uint64, error) {
+	r, err := s.backend.Get(blobRefcountName(hashHex))
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read refcount for chunk %s: %w", hashHex, err)
+	}
+	count, err := strconv.ParseUint(strings.TrimSpace(string(raw)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("corrupt refcount for chunk %s: %w", hashHex, err)
+	}
+	return count, nil
+}
+
+func (s *Service) writeRefcount(hashHex string, count uint64) error {
+	body := strconv.FormatUint(count, 10)
+	if err := s.backend.Put(blobRefcountName(hashHex), strings.NewReader(body)); err != nil {
+		return fmt.Errorf("failed to write refcount for chunk %s: %w", hashHex, err)
+	}
+	return nil
+}
+
+// lockChunk acquires this Service's per-hash lock for hashHex, returning
+// a func to release it. storeChunk and releaseChunk hold it across their
+// whole readRefcount-then-writeRefcount sequence, since that sequence
+// isn't atomic on its own: two goroutines sharing a chunk could otherwise
+// both read the same refcount and write back the same incremented (or
+// decremented) value.
+func (s *Service) lockChunk(hashHex string) func() {
+	muIface, _ := s.chunkLocks.LoadOrStore(hashHex, &sync.Mutex{})
+	mu := muIface.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+// storeChunk uploads ciphertext under blobs/<hashHex>.enc if no object is
+// stored there yet, then increments (or initializes) its refcount. A
+// chunk already referenced by another manifest is left untouched except
+// for the refcount bump -- this is the dedup win.
+func (s *Service) storeChunk(hashHex string, ciphertext []byte) error {
+	defer s.lockChunk(hashHex)()
+
+	count, err := s.readRefcount(hashHex)
+	switch {
+	case err == nil:
+		// Blob already stored; just record one more reference below.
+	case errors.Is(err, ErrObjectNotFound):
+		if err := s.backend.Put(blobName(hashHex), bytes.NewReader(ciphertext)); err != nil {
+			return fmt.Errorf("failed to write chunk blob: %w", err)
+		}
+		count = 0
+	default:
+		return err
+	}
+	return s.writeRefcount(hashHex, count+1)
+}
+
+// releaseChunk drops one reference to the blob identified by hashHex,
+// deleting the blob and its refcount sidecar once no manifest references
+// it any more.
+func (s *Service) releaseChunk(hashHex string) error {
+	defer s.lockChunk(hashHex)()
+
+	count, err := s.readRefcount(hashHex)
+	if err != nil {
+		if errors.Is(err, ErrObjectNotFound) {
+			return nil // already gone
+		}
+		return err
+	}
+
+	if count > 1 {
+		return s.writeRefcount(hashHex, count-1)
+	}
+
+	if err := s.backend.Delete(blobRefcountName(hashHex)); err != nil && !errors.Is(err, ErrObjectNotFound) {
+		return fmt.Errorf("failed to delete refcount for chunk %s: %w", hashHex, err)
+	}
+	if err := s.backend.Delete(blobName(hashHex)); err != nil && !errors.Is(err, ErrObjectNotFound) {
+		return fmt.Errorf("failed to delete chunk %s: %w", hashHex, err)
+	}
+	return nil
+}
+
+// saveFileDedup is SaveFile's dedup-mode implementation: it chunks
+// content, stores each chunk (deduping against existing blobs), and
+// writes the resulting manifest.
+func (s *Service) saveFileDedup(filename string, content io.Reader) error {
+	if err := s.validateFilename(filename); err != nil {
+		return fmt.Errorf("invalid filename: %w", err)
+	}
+
+	manifest := &dedupManifest{Version: dedupManifestVersion}
+	plainHash := sha256.New()
+
+	err := chunkStream(content, func(chunk []byte) error {
+		plainHash.Write(chunk)
+
+		hash, ciphertext, err := encryptChunk(chunk)
+		if err != nil {
+			return err
+		}
+		hashHex := hex.EncodeToString(hash[:])
+		if err := s.storeChunk(hashHex, ciphertext); err != nil {
+			return err
+		}
+
+		manifest.Chunks = append(manifest.Chunks, chunkRef{Hash: hashHex, Size: uint32(len(chunk))})
+		manifest.TotalLen += uint64(len(chunk))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to chunk file content: %w", err)
+	}
+	manifest.PlainSHA256 = hex.EncodeToString(plainHash.Sum(nil))
+
+	// If filename was already saved, its old manifest's chunk refs need to
+	// be released once the new manifest is in place -- otherwise every
+	// chunk unique to the old version leaks forever, and chunks shared
+	// with the new version end up with a permanently inflated refcount.
+	var oldManifest *dedupManifest
+	if _, err := s.backend.Stat(dedupManifestName(filename)); err == nil {
+		oldManifest, err = s.loadDedupManifest(filename)
+		if err != nil {
+			return err
+		}
+	} else if !errors.Is(err, ErrObjectNotFound) {
+		return fmt.Errorf("failed to stat dedup manifest: %w", err)
+	}
+
+	if err := s.saveDedupManifest(filename, manifest); err != nil {
+		return err
+	}
+
+	if oldManifest != nil {
+		for _, ref := range oldManifest.Chunks {
+			if err := s.releaseChunk(ref.Hash); err != nil {
+				return fmt.Errorf("failed to release old chunk %s while overwriting %s: %w", ref.Hash, filename, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) saveDedupManifest(filename string, manifest *dedupManifest) error {
+	raw, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to encode dedup manifest: %w", err)
+	}
+	key, err := s.dedupManifestKey()
+	if err != nil {
+		return err
+	}
+	nonce, ciphertext, err := sealWithKey(key, raw)
+	if err != nil {
+		return err
+	}
+	body := append(nonce, ciphertext...)
+	if err := s.backend.Put(dedupManifestName(filename), bytes.NewReader(body)); err != nil {
+		return fmt.Errorf("failed to write dedup manifest: %w", err)
+	}
+	return nil
+}
+
+func (s *Service) loadDedupManifest(filename string) (*dedupManifest, error) {
+	r, err := s.backend.Get(dedupManifestName(filename))
+	if err != nil {
+		if errors.Is(err, ErrObjectNotFound) {
+			return nil, errors.New("file not found")
+		}
+		return nil, fmt.Errorf("failed to read dedup manifest: %w", err)
+	}
+	defer r.Close()
+
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dedup manifest: %w", err)
+	}
+
+	key, err := s.dedupManifestKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	nonceSize := gcm.NonceSize()
+	if len(raw) < nonceSize {
+		return nil, errors.New("dedup manifest is too small")
+	}
+	plaintext, err := gcm.Open(nil, raw[:nonceSize], raw[nonceSize:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt dedup manifest: %w", err)
+	}
+
+	var manifest dedupManifest
+	if err := json.Unmarshal(plaintext, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse dedup manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// dedupReader implements io.ReadCloser over a dedup-mode file's chunks,
+// fetching and decrypting one blob at a time so callers can stream the
+// plaintext without buffering the whole file.
+type dedupReader struct {
+	s       *Service
+	chunks  []chunkRef
+	idx     int
+	pending []byte
+}
+
+func (s *Service) openFileDedup(filename string) (io.ReadCloser, error) {
+	if err := s.validateFilename(filename); err != nil {
+		return nil, fmt.Errorf("invalid filename: %w", err)
+	}
+	manifest, err := s.loadDedupManifest(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &dedupReader{s: s, chunks: manifest.Chunks}, nil
+}
+
+func (s *Service) loadFileDedup(filename string) ([]byte, error) {
+	rc, err := s.openFileDedup(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func (s *Service) fileSizeDedup(filename string) (int64, error) {
+	if err := s.validateFilename(filename); err != nil {
+		return 0, fmt.Errorf("invalid filename: %w", err)
+	}
+	manifest, err := s.loadDedupManifest(filename)
+	if err != nil {
+		return 0, err
+	}
+	return int64(manifest.TotalLen), nil
+}
+
+func (s *Service) deleteFileDedup(filename string) error {
+	manifest, err := s.loadDedupManifest(filename)
+	if err != nil {
+		return err
+	}
+	for _, ref := range manifest.Chunks {
+		if err := s.releaseChunk(ref.Hash); err != nil {
+			return err
+		}
+	}
+	if err := s.backend.Delete(dedupManifestName(filename)); err != nil && !errors.Is(err, ErrObjectNotFound) {
+		return fmt.Errorf("failed to delete dedup manifest: %w", err)
+	}
+	return nil
+}
+
+func (dr *dedupReader) Read(p []byte) (int, error) {
+	for len(dr.pending) == 0 {
+		if dr.idx >= len(dr.chunks) {
+			return 0, io.EOF
+		}
+		ref := dr.chunks[dr.idx]
+		dr.idx++
+
+		r, err := dr.s.backend.Get(blobName(ref.Hash))
+		if err != nil {
+			return 0, fmt.Errorf("failed to read chunk %s: %w", ref.Hash, err)
+		}
+		ciphertext, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return 0, fmt.Errorf("failed to read chunk %s: %w", ref.Hash, err)
+		}
+
+		chunk, err := decryptChunk(ref.Hash, ciphertext)
+		if err != nil {
+			return 0, err
+		}
+		dr.pending = chunk
+	}
+
+	n := copy(p, dr.pending)
+	dr.pending = dr.pending[n:]
+	return n, nil
+}
+
+func (dr *dedupReader) Close() error {
+	return nil
+}
@@ -0,0 +1,275 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"os"
+	"testing"
+)
+
+func newDedupTestService(t *testing.T) *Service {
+	t.Helper()
+	tmpDir, err := os.MkdirTemp("", "dedup_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tmpDir) })
+
+	svc, err := NewServiceWithDedup("12345678901234567890123456789012", NewLocalBackend(tmpDir))
+	if err != nil {
+		t.Fatalf("NewServiceWithDedup failed: %v", err)
+	}
+	return svc
+}
+
+func TestChunkStreamRespectsSizeBounds(t *testing.T) {
+	data := make([]byte, 8*dedupAvgChunkSize)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("failed to generate random data: %v", err)
+	}
+
+	var chunks [][]byte
+	err := chunkStream(bytes.NewReader(data), func(chunk []byte) error {
+		chunks = append(chunks, append([]byte(nil), chunk...))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("chunkStream failed: %v", err)
+	}
+
+	var total int
+	for i, c := range chunks {
+		total += len(c)
+		last := i == len(chunks)-1
+		if len(c) < dedupMinChunkSize && !last {
+			t.Errorf("chunk %d is %d bytes, below min %d", i, len(c), dedupMinChunkSize)
+		}
+		if len(c) > dedupMaxChunkSize {
+			t.Errorf("chunk %d is %d bytes, above max %d", i, len(c), dedupMaxChunkSize)
+		}
+	}
+	if total != len(data) {
+		t.Errorf("chunks total %d bytes, want %d", total, len(data))
+	}
+}
+
+func TestSaveAndLoadFileDedup(t *testing.T) {
+	svc := newDedupTestService(t)
+	content := bytes.Repeat([]byte("dedup roundtrip content "), 100000)
+
+	if err := svc.SaveFile("report.txt", bytes.NewReader(content)); err != nil {
+		t.Fatalf("SaveFile failed: %v", err)
+	}
+
+	got, err := svc.LoadFile("report.txt")
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("loaded content does not match saved content")
+	}
+
+	size, err := svc.FileSize("report.txt")
+	if err != nil {
+		t.Fatalf("FileSize failed: %v", err)
+	}
+	if size != int64(len(content)) {
+		t.Errorf("FileSize = %d, want %d", size, len(content))
+	}
+
+	if !svc.FileExists("report.txt") {
+		t.Error("FileExists = false, want true")
+	}
+}
+
+func TestDedupReusesIdenticalChunks(t *testing.T) {
+	svc := newDedupTestService(t)
+	content := bytes.Repeat([]byte("shared payload across two uploads "), 100000)
+
+	if err := svc.SaveFile("first.txt", bytes.NewReader(content)); err != nil {
+		t.Fatalf("SaveFile(first) failed: %v", err)
+	}
+	if err := svc.SaveFile("second.txt", bytes.NewReader(content)); err != nil {
+		t.Fatalf("SaveFile(second) failed: %v", err)
+	}
+
+	firstManifest, err := svc.loadDedupManifest("first.txt")
+	if err != nil {
+		t.Fatalf("loadDedupManifest(first) failed: %v", err)
+	}
+	secondManifest, err := svc.loadDedupManifest("second.txt")
+	if err != nil {
+		t.Fatalf("loadDedupManifest(second) failed: %v", err)
+	}
+	if len(firstManifest.Chunks) != len(secondManifest.Chunks) {
+		t.Fatalf("chunk count differs: %d vs %d", len(firstManifest.Chunks), len(secondManifest.Chunks))
+	}
+
+	for i, ref := range firstManifest.Chunks {
+		if ref.Hash != secondManifest.Chunks[i].Hash {
+			t.Fatalf("chunk %d hash differs between identical files", i)
+		}
+		count, err := svc.readRefcount(ref.Hash)
+		if err != nil {
+			t.Fatalf("readRefcount(%s) failed: %v", ref.Hash, err)
+		}
+		if count != 2 {
+			t.Errorf("chunk %s refcount = %d, want 2", ref.Hash, count)
+		}
+	}
+}
+
+func TestDeleteFileDedupGarbageCollectsUnsharedChunks(t *testing.T) {
+	svc := newDedupTestService(t)
+	content := bytes.Repeat([]byte("solo file chunk content "), 100000)
+
+	if err := svc.SaveFile("solo.txt", bytes.NewReader(content)); err != nil {
+		t.Fatalf("SaveFile failed: %v", err)
+	}
+
+	manifest, err := svc.loadDedupManifest("solo.txt")
+	if err != nil {
+		t.Fatalf("loadDedupManifest failed: %v", err)
+	}
+
+	if err := svc.DeleteFile("solo.txt"); err != nil {
+		t.Fatalf("DeleteFile failed: %v", err)
+	}
+
+	if svc.FileExists("solo.txt") {
+		t.Error("FileExists = true after DeleteFile")
+	}
+	for _, ref := range manifest.Chunks {
+		if _, err := svc.backend.Stat(blobName(ref.Hash)); !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("chunk %s blob still present after delete", ref.Hash)
+		}
+		if _, err := svc.readRefcount(ref.Hash); !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("chunk %s refcount still present after delete", ref.Hash)
+		}
+	}
+}
+
+func TestDeleteFileDedupKeepsChunksStillReferenced(t *testing.T) {
+	svc := newDedupTestService(t)
+	content := bytes.Repeat([]byte("shared between two files, one deleted "), 100000)
+
+	if err := svc.SaveFile("keep.txt", bytes.NewReader(content)); err != nil {
+		t.Fatalf("SaveFile(keep) failed: %v", err)
+	}
+	if err := svc.SaveFile("remove.txt", bytes.NewReader(content)); err != nil {
+		t.Fatalf("SaveFile(remove) failed: %v", err)
+	}
+
+	if err := svc.DeleteFile("remove.txt"); err != nil {
+		t.Fatalf("DeleteFile failed: %v", err)
+	}
+
+	got, err := svc.LoadFile("keep.txt")
+	if err != nil {
+		t.Fatalf("LoadFile(keep) failed after sibling delete: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("surviving file's content changed after sibling delete")
+	}
+}
+
+func TestSaveFileDedupReleasesOldChunksOnOverwrite(t *testing.T) {
+	svc := newDedupTestService(t)
+	oldContent := bytes.Repeat([]byte("first version of the file "), 100000)
+	newContent := bytes.Repeat([]byte("second version, totally different "), 100000)
+
+	if err := svc.SaveFile("doc.txt", bytes.NewReader(oldContent)); err != nil {
+		t.Fatalf("SaveFile(old) failed: %v", err)
+	}
+	oldManifest, err := svc.loadDedupManifest("doc.txt")
+	if err != nil {
+		t.Fatalf("loadDedupManifest(old) failed: %v", err)
+	}
+
+	if err := svc.SaveFile("doc.txt", bytes.NewReader(newContent)); err != nil {
+		t.Fatalf("SaveFile(new) failed: %v", err)
+	}
+
+	got, err := svc.LoadFile("doc.txt")
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if !bytes.Equal(got, newContent) {
+		t.Error("loaded content does not match the overwritten version")
+	}
+
+	for _, ref := range oldManifest.Chunks {
+		if _, err := svc.backend.Stat(blobName(ref.Hash)); !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("old version's chunk %s blob still present after overwrite", ref.Hash)
+		}
+		if _, err := svc.readRefcount(ref.Hash); !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("old version's chunk %s refcount still present after overwrite", ref.Hash)
+		}
+	}
+}
+
+func TestConcurrentSaveFileSharingAChunkRefcountsCorrectly(t *testing.T) {
+	svc := newDedupTestService(t)
+	// One chunk's worth of content so both files store (and refcount)
+	// exactly the same single chunk.
+	content := bytes.Repeat([]byte("shared chunk uploaded concurrently "), 100)
+
+	errs := make(chan error, 2)
+	go func() { errs <- svc.SaveFile("a.txt", bytes.NewReader(content)) }()
+	go func() { errs <- svc.SaveFile("b.txt", bytes.NewReader(content)) }()
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("SaveFile failed: %v", err)
+		}
+	}
+
+	manifest, err := svc.loadDedupManifest("a.txt")
+	if err != nil {
+		t.Fatalf("loadDedupManifest failed: %v", err)
+	}
+	if len(manifest.Chunks) != 1 {
+		t.Fatalf("expected content to chunk to exactly 1 chunk, got %d", len(manifest.Chunks))
+	}
+
+	count, err := svc.readRefcount(manifest.Chunks[0].Hash)
+	if err != nil {
+		t.Fatalf("readRefcount failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("refcount after two concurrent savers sharing a chunk = %d, want 2", count)
+	}
+
+	// Deleting one file must not garbage-collect the chunk the other
+	// still references.
+	if err := svc.DeleteFile("a.txt"); err != nil {
+		t.Fatalf("DeleteFile(a.txt) failed: %v", err)
+	}
+	got, err := svc.LoadFile("b.txt")
+	if err != nil {
+		t.Fatalf("LoadFile(b.txt) failed after sibling delete: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("surviving file's content changed after sibling delete")
+	}
+}
+
+func TestConvergentEncryptionIsDeterministic(t *testing.T) {
+	chunk := []byte("identical plaintext chunk")
+
+	hash1, ciphertext1, err := encryptChunk(chunk)
+	if err != nil {
+		t.Fatalf("encryptChunk failed: %v", err)
+	}
+	hash2, ciphertext2, err := encryptChunk(chunk)
+	if err != nil {
+		t.Fatalf("encryptChunk failed: %v", err)
+	}
+
+	if hash1 != hash2 {
+		t.Error("identical plaintext produced different content hashes")
+	}
+	if !bytes.Equal(ciphertext1, ciphertext2) {
+		t.Error("identical plaintext produced different ciphertext under convergent encryption")
+	}
+}
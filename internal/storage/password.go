@@ -0,0 +1,264 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/scrypt"
+)
+
+// passwordFileMagic identifies a password-encrypted file, as opposed to
+// the regular STORAGE_KEY-encrypted format (fileMagic).
+var passwordFileMagic = [4]byte{'S', 'S', 'F', 'P'}
+
+const passwordFileVersion = 2
+
+// scrypt parameters for deriving per-file keys from a user-supplied
+// password. These match the scrypt-recommended interactive parameters.
+const (
+	scryptN    = 1 << 15 // 32768
+	scryptR    = 8
+	scryptP    = 1
+	scryptKeys = 64 // file key (32) + header MAC key (32)
+)
+
+const saltSize = 16
+const macSize = sha256.Size
+
+// passwordHeaderSize is everything written before the framed ciphertext:
+// magic(4) + version(1) + salt(16) + N(4) + r(4) + p(4) + noncePrefix(8) +
+// mac(32). The body that follows is the same length-prefixed frame format
+// encodeFrames/frameReader use for SaveFile/OpenFile (see storage.go),
+// just sealed under a key derived from password instead of s.key.
+const passwordHeaderSize = 4 + 1 + saltSize + 4 + 4 + 4 + noncePrefixSize + macSize
+
+// ErrWrongPassword is returned by LoadFileWithPassword when the supplied
+// password fails the header's MAC check. Handlers use this to return 401
+// rather than treating it as generic corrupt data.
+var ErrWrongPassword = errors.New("wrong password")
+
+// derivePasswordKeys stretches a password into a file-encryption key and a
+// header-authentication key via scrypt followed by HKDF. Using two
+// distinct keys means the header MAC never touches the same key material
+// used to seal the plaintext.
+func derivePasswordKeys(password string, salt []byte, n, r, p int) (fileKey, macKey []byte, err error) {
+	master, err := scrypt.Key([]byte(password), salt, n, r, p, 32)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+
+	kdf := hkdf.New(sha256.New, master, salt, []byte("secure-storage/password-file"))
+	out := make([]byte, scryptKeys)
+	if _, err := io.ReadFull(kdf, out); err != nil {
+		return nil, nil, fmt.Errorf("failed to expand key: %w", err)
+	}
+	return out[:32], out[32:], nil
+}
+
+// IsPasswordProtected reports whether the stored file was encrypted with
+// SaveFileWithPassword rather than the global STORAGE_KEY.
+func (s *Service) IsPasswordProtected(filename string) (bool, error) {
+	if err := s.validateFilename(filename); err != nil {
+		return false, fmt.Errorf("invalid filename: %w", err)
+	}
+
+	if s.dedup {
+		// SaveFileWithPassword always writes filename+".enc" directly,
+		// bypassing the dedup path entirely, so a dedup manifest existing
+		// for filename means it was saved via the regular (non-password)
+		// SaveFile and there's no ".enc" object to inspect.
+		if _, err := s.backend.Stat(dedupManifestName(filename)); err == nil {
+			return false, nil
+		} else if !errors.Is(err, ErrObjectNotFound) {
+			return false, fmt.Errorf("failed to stat dedup manifest: %w", err)
+		}
+	}
+
+	r, err := s.backend.Get(filename + ".enc")
+	if err != nil {
+		if errors.Is(err, ErrObjectNotFound) {
+			return false, errors.New("file not found")
+		}
+		return false, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer r.Close()
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return false, fmt.Errorf("failed to read file magic: %w", err)
+	}
+	return [4]byte(magic) == passwordFileMagic, nil
+}
+
+// buildPasswordHeader assembles the header (everything but its trailing
+// MAC) that precedes a password-encrypted file's frames: magic, version,
+// salt, scrypt parameters, and the frame nonce prefix.
+func buildPasswordHeader(salt, noncePrefix []byte) []byte {
+	header := make([]byte, passwordHeaderSize-macSize)
+	copy(header[0:4], passwordFileMagic[:])
+	header[4] = passwordFileVersion
+	copy(header[5:5+saltSize], salt)
+	offset := 5 + saltSize
+	binary.BigEndian.PutUint32(header[offset:], uint32(scryptN))
+	binary.BigEndian.PutUint32(header[offset+4:], uint32(scryptR))
+	binary.BigEndian.PutUint32(header[offset+8:], uint32(scryptP))
+	copy(header[offset+12:], noncePrefix)
+	return header
+}
+
+// SaveFileWithPassword encrypts content with a key derived from password
+// rather than the service's global key, and stores the scrypt salt and
+// parameters alongside the ciphertext so LoadFileWithPassword can later
+// re-derive the same key. Like SaveFile, the plaintext is streamed in
+// fixed-size frames (see encodeFrames/writeFrames in storage.go) rather
+// than read into memory all at once.
+func (s *Service) SaveFileWithPassword(filename string, content io.Reader, password string) error {
+	if err := s.validateFilename(filename); err != nil {
+		return fmt.Errorf("invalid filename: %w", err)
+	}
+	if password == "" {
+		return errors.New("password cannot be empty")
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	fileKey, macKey, err := derivePasswordKeys(password, salt, scryptN, scryptR, scryptP)
+	if err != nil {
+		return err
+	}
+
+	block, err := aes.NewCipher(fileKey)
+	if err != nil {
+		return fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	noncePrefix := make([]byte, noncePrefixSize)
+	if _, err := io.ReadFull(rand.Reader, noncePrefix); err != nil {
+		return fmt.Errorf("failed to generate nonce prefix: %w", err)
+	}
+
+	header := buildPasswordHeader(salt, noncePrefix)
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(header)
+	headerWithMAC := append(header, mac.Sum(nil)...)
+
+	pr, pw := io.Pipe()
+	var totalLen uint64
+	go func() {
+		pw.CloseWithError(writeFrames(pw, content, gcm, s.chunkSize, noncePrefix, &totalLen))
+	}()
+
+	body := io.MultiReader(bytes.NewReader(headerWithMAC), pr)
+	if err := s.backend.Put(filename+".enc", body); err != nil {
+		pr.CloseWithError(err)
+		return fmt.Errorf("failed to write encrypted file: %w", err)
+	}
+
+	return nil
+}
+
+// OpenFileWithPassword opens a file previously saved with
+// SaveFileWithPassword for streaming decryption. It validates the
+// header's MAC (derived from the supplied password) before returning a
+// reader over the frames, so a wrong password is reported distinctly
+// from corrupted ciphertext rather than surfacing partway through a
+// stream.
+func (s *Service) OpenFileWithPassword(filename string, password string) (io.ReadCloser, error) {
+	if err := s.validateFilename(filename); err != nil {
+		return nil, fmt.Errorf("invalid filename: %w", err)
+	}
+
+	rc, err := s.backend.Get(filename + ".enc")
+	if err != nil {
+		if errors.Is(err, ErrObjectNotFound) {
+			return nil, errors.New("file not found")
+		}
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	header := make([]byte, passwordHeaderSize-macSize)
+	storedMAC := make([]byte, macSize)
+	if _, err := io.ReadFull(rc, header); err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("failed to read file header: %w", err)
+	}
+	if _, err := io.ReadFull(rc, storedMAC); err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("failed to read file header: %w", err)
+	}
+
+	if [4]byte(header[0:4]) != passwordFileMagic {
+		rc.Close()
+		return nil, errors.New("not a password-encrypted file (bad magic)")
+	}
+	if header[4] != passwordFileVersion {
+		rc.Close()
+		return nil, fmt.Errorf("unsupported file version %d", header[4])
+	}
+
+	salt := header[5 : 5+saltSize]
+	offset := 5 + saltSize
+	n := binary.BigEndian.Uint32(header[offset:])
+	r := binary.BigEndian.Uint32(header[offset+4:])
+	p := binary.BigEndian.Uint32(header[offset+8:])
+	noncePrefix := append([]byte(nil), header[offset+12:offset+12+noncePrefixSize]...)
+
+	fileKey, macKey, err := derivePasswordKeys(password, salt, int(n), int(r), int(p))
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(header)
+	expectedMAC := mac.Sum(nil)
+	if !hmac.Equal(expectedMAC, storedMAC) {
+		rc.Close()
+		return nil, ErrWrongPassword
+	}
+
+	block, err := aes.NewCipher(fileKey)
+	if err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	return &frameReader{
+		r:           rc,
+		gcm:         gcm,
+		noncePrefix: noncePrefix,
+	}, nil
+}
+
+// LoadFileWithPassword decrypts a file previously saved with
+// SaveFileWithPassword by reading OpenFileWithPassword's stream to
+// completion.
+func (s *Service) LoadFileWithPassword(filename string, password string) ([]byte, error) {
+	rc, err := s.OpenFileWithPassword(filename, password)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
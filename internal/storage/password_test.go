@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestSaveAndLoadFileWithPassword(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "storage_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	svc, err := NewService("12345678901234567890123456789012", tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+
+	testData := []byte("top secret, password protected")
+	filename := "secret.txt"
+	password := "correct horse battery staple"
+
+	if err := svc.SaveFileWithPassword(filename, bytes.NewReader(testData), password); err != nil {
+		t.Fatalf("SaveFileWithPassword failed: %v", err)
+	}
+
+	protected, err := svc.IsPasswordProtected(filename)
+	if err != nil {
+		t.Fatalf("IsPasswordProtected failed: %v", err)
+	}
+	if !protected {
+		t.Error("expected file to be reported as password-protected")
+	}
+
+	loaded, err := svc.LoadFileWithPassword(filename, password)
+	if err != nil {
+		t.Fatalf("LoadFileWithPassword failed: %v", err)
+	}
+	if !bytes.Equal(loaded, testData) {
+		t.Errorf("loaded data does not match original.\nGot: %s\nWant: %s", loaded, testData)
+	}
+}
+
+func TestLoadFileWithPasswordWrongPassword(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "storage_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	svc, err := NewService("12345678901234567890123456789012", tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+
+	filename := "secret.txt"
+	if err := svc.SaveFileWithPassword(filename, bytes.NewReader([]byte("data")), "rightpassword"); err != nil {
+		t.Fatalf("SaveFileWithPassword failed: %v", err)
+	}
+
+	_, err = svc.LoadFileWithPassword(filename, "wrongpassword")
+	if !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("expected ErrWrongPassword, got %v", err)
+	}
+}
+
+func TestSaveAndLoadFileWithPasswordMultiChunk(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "storage_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	svc, err := NewService("12345678901234567890123456789012", tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	// Use a tiny chunk size so a modest test payload spans many frames,
+	// exercising the same streaming frame format as SaveFile/LoadFile.
+	svc.chunkSize = 16
+
+	testData := bytes.Repeat([]byte("0123456789abcdef"), 100)
+	filename := "multichunk-secret.bin"
+	password := "correct horse battery staple"
+
+	if err := svc.SaveFileWithPassword(filename, bytes.NewReader(testData), password); err != nil {
+		t.Fatalf("SaveFileWithPassword failed: %v", err)
+	}
+
+	loaded, err := svc.LoadFileWithPassword(filename, password)
+	if err != nil {
+		t.Fatalf("LoadFileWithPassword failed: %v", err)
+	}
+	if !bytes.Equal(loaded, testData) {
+		t.Error("loaded data does not match original for multi-chunk password-protected file")
+	}
+}
+
+func TestOpenFileWithPasswordStreaming(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "storage_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	svc, err := NewService("12345678901234567890123456789012", tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	svc.chunkSize = 16
+
+	testData := bytes.Repeat([]byte("streaming-data-"), 50)
+	filename := "stream-secret.bin"
+	password := "hunter2"
+
+	if err := svc.SaveFileWithPassword(filename, bytes.NewReader(testData), password); err != nil {
+		t.Fatalf("SaveFileWithPassword failed: %v", err)
+	}
+
+	rc, err := svc.OpenFileWithPassword(filename, password)
+	if err != nil {
+		t.Fatalf("OpenFileWithPassword failed: %v", err)
+	}
+	defer rc.Close()
+
+	streamed, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("reading from OpenFileWithPassword failed: %v", err)
+	}
+	if !bytes.Equal(streamed, testData) {
+		t.Error("streamed data does not match original")
+	}
+}
+
+func TestOpenFileWithPasswordWrongPassword(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "storage_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	svc, err := NewService("12345678901234567890123456789012", tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+
+	filename := "secret.txt"
+	if err := svc.SaveFileWithPassword(filename, bytes.NewReader([]byte("data")), "rightpassword"); err != nil {
+		t.Fatalf("SaveFileWithPassword failed: %v", err)
+	}
+
+	_, err = svc.OpenFileWithPassword(filename, "wrongpassword")
+	if !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("expected ErrWrongPassword, got %v", err)
+	}
+}
+
+func TestIsPasswordProtectedFalseForDedupFile(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "storage_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	svc, err := NewServiceWithDedup("12345678901234567890123456789012", NewLocalBackend(tmpDir))
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+
+	filename := "plain.txt"
+	if err := svc.SaveFile(filename, bytes.NewReader([]byte("data"))); err != nil {
+		t.Fatalf("SaveFile failed: %v", err)
+	}
+
+	protected, err := svc.IsPasswordProtected(filename)
+	if err != nil {
+		t.Fatalf("IsPasswordProtected failed: %v", err)
+	}
+	if protected {
+		t.Error("expected dedup-mode file to not be reported as password-protected")
+	}
+}
+
+func TestIsPasswordProtectedFalseForRegularFile(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "storage_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	svc, err := NewService("12345678901234567890123456789012", tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+
+	filename := "plain.txt"
+	if err := svc.SaveFile(filename, bytes.NewReader([]byte("data"))); err != nil {
+		t.Fatalf("SaveFile failed: %v", err)
+	}
+
+	protected, err := svc.IsPasswordProtected(filename)
+	if err != nil {
+		t.Fatalf("IsPasswordProtected failed: %v", err)
+	}
+	if protected {
+		t.Error("expected regular file to not be reported as password-protected")
+	}
+}
@@ -1,29 +1,77 @@
 package storage
 
 import (
+	"bufio"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
-	"crypto/sha256"
-	"encoding/hex"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
-	"os"
-	"path/filepath"
+	"math"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 )
 
+// fileMagic identifies an encrypted file produced by this package.
+var fileMagic = [4]byte{'S', 'S', 'F', '1'}
+
+const fileVersion = 1
+
+// defaultChunkSize is the size of plaintext read per frame. Keeping frames
+// small and fixed-size means SaveFile's encoder and OpenFile's reader never
+// hold more than one frame's worth of plaintext or ciphertext in memory at
+// a time, regardless of the total file size. LoadFile still returns the
+// whole plaintext, and a Backend's Put may buffer the whole object (as
+// S3Backend and AzureBlobBackend do).
+const defaultChunkSize = 64 * 1024
+
+// headerSize is the fixed-size header written at the start of every .enc
+// object: magic(4) + version(1) + chunkSize(4) + noncePrefix(8).
+const headerSize = 4 + 1 + 4 + 8
+
+// noncePrefixSize is the random portion of each frame's nonce. The
+// remaining 4 bytes are a big-endian frame counter, so the full 12-byte
+// GCM nonce is never reused for a given file.
+const noncePrefixSize = 8
+
 // Service handles encrypted file operations
 type Service struct {
-	key     []byte
-	dataDir string
-	gcm     cipher.AEAD
+	key       []byte
+	backend   Backend
+	gcm       cipher.AEAD
+	chunkSize uint32
+	dedup     bool
+
+	// chunkLocks serializes storeChunk/releaseChunk (see dedup.go) per
+	// chunk hash, one *sync.Mutex per hashHex ever seen. Without it, two
+	// concurrent SaveFile calls sharing a chunk can both read the same
+	// stale refcount and write back the same incremented value,
+	// undercounting references.
+	chunkLocks sync.Map
+
+	// fileLocks serializes GrantAccess/RevokeAccess (see access.go) per
+	// filename, one *sync.Mutex per filename ever seen. Both do a
+	// load-manifest, modify, save-manifest sequence that isn't atomic on
+	// its own: two concurrent calls sharing a filename could otherwise
+	// both load the same manifest and save back conflicting updates,
+	// silently losing whichever one saved first.
+	fileLocks sync.Map
 }
 
-// NewService creates a new storage service with the given encryption key
+// NewService creates a new storage service with the given encryption key,
+// storing encrypted files under dataDir on local disk.
 func NewService(key string, dataDir string) (*Service, error) {
+	return NewServiceWithBackend(key, NewLocalBackend(dataDir))
+}
+
+// NewServiceWithBackend creates a new storage service with the given
+// encryption key, storing encrypted files in backend. This is the
+// constructor to use for non-local backends (S3, Azure Blob, ...).
+func NewServiceWithBackend(key string, backend Backend) (*Service, error) {
 	keyBytes := []byte(key)
 
 	// Create the cipher block
@@ -38,13 +86,35 @@ func NewService(key string, dataDir string) (*Service, error) {
 		return nil, fmt.Errorf("failed to create GCM: %w", err)
 	}
 
+	if gcm.NonceSize() != noncePrefixSize+4 {
+		return nil, fmt.Errorf("unexpected GCM nonce size %d", gcm.NonceSize())
+	}
+
 	return &Service{
-		key:     keyBytes,
-		dataDir: dataDir,
-		gcm:     gcm,
+		key:       keyBytes,
+		backend:   backend,
+		gcm:       gcm,
+		chunkSize: defaultChunkSize,
 	}, nil
 }
 
+// NewServiceWithDedup creates a storage service like NewServiceWithBackend,
+// but with content-addressed chunk deduplication enabled (see dedup.go):
+// SaveFile/LoadFile/DeleteFile split files into content-defined chunks
+// that are stored once per distinct chunk, no matter how many filenames
+// reference them. This is opt-in rather than the default behavior of
+// NewServiceWithBackend because convergent encryption (required for
+// chunks to dedupe across uploads) lets anyone who can guess a chunk's
+// plaintext confirm whether it's already stored.
+func NewServiceWithDedup(key string, backend Backend) (*Service, error) {
+	s, err := NewServiceWithBackend(key, backend)
+	if err != nil {
+		return nil, err
+	}
+	s.dedup = true
+	return s, nil
+}
+
 // validateFilename checks for path traversal and other dangerous patterns
 func (s *Service) validateFilename(filename string) error {
 	// Check for empty filename
@@ -76,113 +146,318 @@ func (s *Service) validateFilename(filename string) error {
 	return nil
 }
 
-// SaveFile encrypts and saves a file to disk
+// frameNonce builds the 12-byte GCM nonce for a frame: the file's random
+// 8-byte prefix followed by a big-endian 4-byte frame counter.
+func frameNonce(noncePrefix []byte, counter uint32) []byte {
+	nonce := make([]byte, noncePrefixSize+4)
+	copy(nonce, noncePrefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], counter)
+	return nonce
+}
+
+// frameAAD binds the frame counter and "is this the last frame" bit into
+// the GCM authentication tag, so frames cannot be dropped, reordered, or
+// have a non-final frame swapped in as the final one without decryption
+// failing.
+func frameAAD(counter uint32, final bool) []byte {
+	aad := make([]byte, 5)
+	binary.BigEndian.PutUint32(aad, counter)
+	if final {
+		aad[4] = 1
+	}
+	return aad
+}
+
+// writeHeader writes the fixed-size header: magic, version, chunk size,
+// and random nonce prefix.
+func writeHeader(w io.Writer, chunkSize uint32, noncePrefix []byte) error {
+	header := make([]byte, headerSize)
+	copy(header[0:4], fileMagic[:])
+	header[4] = fileVersion
+	binary.BigEndian.PutUint32(header[5:9], chunkSize)
+	copy(header[9:9+noncePrefixSize], noncePrefix)
+	_, err := w.Write(header)
+	return err
+}
+
+// readHeader parses and validates the fixed-size header.
+func readHeader(r io.Reader) (chunkSize uint32, noncePrefix []byte, err error) {
+	header := make([]byte, headerSize)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return 0, nil, fmt.Errorf("failed to read file header: %w", err)
+	}
+	if [4]byte(header[0:4]) != fileMagic {
+		return 0, nil, errors.New("not a recognized encrypted file (bad magic)")
+	}
+	if header[4] != fileVersion {
+		return 0, nil, fmt.Errorf("unsupported file version %d", header[4])
+	}
+	chunkSize = binary.BigEndian.Uint32(header[5:9])
+	noncePrefix = append([]byte(nil), header[9:9+noncePrefixSize]...)
+	return chunkSize, noncePrefix, nil
+}
+
+// SaveFile encrypts and saves a file via the service's Backend. The
+// plaintext is streamed in fixed-size frames so Service itself never holds
+// the whole file in memory at once, which matters for large uploads (the
+// Backend's Put may still buffer the object; S3Backend and
+// AzureBlobBackend read it fully before uploading); a pipe feeds
+// the encrypted frames to Backend.Put as they're produced rather than
+// buffering them, since a Backend (e.g. S3) may not support seeking back
+// to patch a header once the upload has started.
 func (s *Service) SaveFile(filename string, content io.Reader) error {
+	if s.dedup {
+		return s.saveFileDedup(filename, content)
+	}
+
 	// Validate the filename first
 	if err := s.validateFilename(filename); err != nil {
 		return fmt.Errorf("invalid filename: %w", err)
 	}
 
-	// 1. Setup Hasher
-	hasher := sha256.New()
+	// Generate the random nonce prefix shared by every frame in this file
+	noncePrefix := make([]byte, noncePrefixSize)
+	if _, err := io.ReadFull(rand.Reader, noncePrefix); err != nil {
+		return fmt.Errorf("failed to generate nonce prefix: %w", err)
+	}
 
-	// 2. "Tee" the stream: Read from content -> Write to Hasher AND Encryption
-	// This allows us to hash the PLAINTEXT while reading
-	teeReader := io.TeeReader(content, hasher)
+	pr, pw := io.Pipe()
+	var totalLen uint64
+	go func() {
+		pw.CloseWithError(s.encodeFrames(pw, content, noncePrefix, &totalLen))
+	}()
+
+	if err := s.backend.Put(filename+".enc", pr); err != nil {
+		// backend.Put may give up before draining pr to EOF (e.g.
+		// LocalBackend.Put's io.Copy stops as soon as the disk write
+		// fails), which would otherwise leave the encodeFrames goroutine
+		// blocked forever on pw.Write. Closing the read side with the
+		// same error unblocks it: CloseWithError makes any pending or
+		// future pw.Write return it instead.
+		pr.CloseWithError(err)
+		return fmt.Errorf("failed to write encrypted file: %w", err)
+	}
 
-	// Read all data from the tee reader to get the byte slice for encryption
-	data, err := io.ReadAll(teeReader)
-	if err != nil {
-		return fmt.Errorf("failed to read file content: %w", err)
+	// Stash the plaintext length in a small sidecar so FileSize (used for
+	// Content-Length) doesn't have to decrypt the whole file to learn it.
+	// totalLen is safe to read here: Put only returns once it has read pr
+	// through to EOF, which happens after encodeFrames has finished.
+	sizeStr := strconv.FormatUint(totalLen, 10)
+	if err := s.backend.Put(filename+".size", strings.NewReader(sizeStr)); err != nil {
+		return fmt.Errorf("failed to write size sidecar: %w", err)
 	}
 
-	// Generate random nonce for GCM
-	nonce := make([]byte, s.gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return fmt.Errorf("failed to generate nonce: %w", err)
+	return nil
+}
+
+// encodeFrames writes the header and every encrypted frame for content to
+// w, recording the total plaintext length read into *totalLen.
+func (s *Service) encodeFrames(w io.Writer, content io.Reader, noncePrefix []byte, totalLen *uint64) error {
+	if err := writeHeader(w, s.chunkSize, noncePrefix); err != nil {
+		return fmt.Errorf("failed to write file header: %w", err)
 	}
+	return writeFrames(w, content, s.gcm, s.chunkSize, noncePrefix, totalLen)
+}
 
-	// Encrypt the data
-	// The nonce is prepended to the ciphertext
-	encrypted := s.gcm.Seal(nonce, nonce, data, nil)
+// writeFrames writes every encrypted frame for content to w under gcm,
+// recording the total plaintext length read into *totalLen. It's the
+// frame-loop half of encodeFrames, factored out so other callers (e.g.
+// SaveFileWithPassword) can stream frames under a key of their own rather
+// than the service's global s.gcm, while writing whatever header precedes
+// the frames themselves.
+func writeFrames(w io.Writer, content io.Reader, gcm cipher.AEAD, chunkSize uint32, noncePrefix []byte, totalLen *uint64) error {
+	bufReader := bufio.NewReaderSize(content, int(chunkSize))
+	buf := make([]byte, chunkSize)
+
+	var counter uint32
+
+	for {
+		n, readErr := io.ReadFull(bufReader, buf)
+		if readErr != nil && readErr != io.ErrUnexpectedEOF && readErr != io.EOF {
+			return fmt.Errorf("failed to read file content: %w", readErr)
+		}
 
-	// Build the file path
-	filePath := filepath.Join(s.dataDir, filename+".enc")
+		// Peek to see whether any plaintext remains; if not, this is the
+		// final frame and its AAD's "is final" bit must say so.
+		_, peekErr := bufReader.Peek(1)
+		if peekErr != nil && peekErr != io.EOF {
+			return fmt.Errorf("failed to read file content: %w", peekErr)
+		}
+		final := peekErr == io.EOF
 
-	// Write to file
-	if err := os.WriteFile(filePath, encrypted, 0600); err != nil {
-		return fmt.Errorf("failed to write encrypted file: %w", err)
+		if counter == math.MaxUint32 {
+			return errors.New("file too large: frame counter would overflow")
+		}
+
+		chunk := buf[:n]
+		nonce := frameNonce(noncePrefix, counter)
+		sealed := gcm.Seal(nil, nonce, chunk, frameAAD(counter, final))
+
+		frameLen := make([]byte, 4)
+		binary.BigEndian.PutUint32(frameLen, uint32(len(sealed)))
+		if _, err := w.Write(frameLen); err != nil {
+			return fmt.Errorf("failed to write frame length: %w", err)
+		}
+		if _, err := w.Write(sealed); err != nil {
+			return fmt.Errorf("failed to write frame: %w", err)
+		}
+
+		*totalLen += uint64(n)
+		counter++
+
+		if final {
+			return nil
+		}
 	}
+}
 
-	// 4. Get the Checksum
-	checksum := hex.EncodeToString(hasher.Sum(nil))
+// LoadFile reads and decrypts a file, verifying every frame.
+func (s *Service) LoadFile(filename string) ([]byte, error) {
+	if s.dedup {
+		return s.loadFileDedup(filename)
+	}
 
-	// 5. Save Checksum (e.g., filename.sha256)
-	checksumPath := filepath.Join(s.dataDir, filename+".sha256")
-	if err := os.WriteFile(checksumPath, []byte(checksum), 0644); err != nil {
-		return fmt.Errorf("failed to write checksum file: %w", err)
+	rc, err := s.OpenFile(filename)
+	if err != nil {
+		return nil, err
 	}
+	defer rc.Close()
 
-	return nil
+	plaintext, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	return plaintext, nil
 }
 
-// LoadFile reads and decrypts a file from disk
-func (s *Service) LoadFile(filename string) ([]byte, error) {
-	// Validate filename
+// frameReader implements io.ReadCloser over an encrypted object,
+// decrypting and authenticating one frame at a time so callers can stream
+// the plaintext out (e.g. straight to an HTTP response) without buffering
+// the whole file.
+type frameReader struct {
+	r           io.ReadCloser
+	gcm         cipher.AEAD
+	noncePrefix []byte
+	counter     uint32
+	pending     []byte
+	done        bool
+}
+
+// OpenFile opens an encrypted file for streaming decryption. The returned
+// io.ReadCloser must be closed by the caller.
+func (s *Service) OpenFile(filename string) (io.ReadCloser, error) {
+	if s.dedup {
+		return s.openFileDedup(filename)
+	}
+
 	if err := s.validateFilename(filename); err != nil {
 		return nil, fmt.Errorf("invalid filename: %w", err)
 	}
 
-	// Build the file path
-	filePath := filepath.Join(s.dataDir, filename+".enc")
-
-	// Read the encrypted file
-	encrypted, err := os.ReadFile(filePath)
+	r, err := s.backend.Get(filename + ".enc")
 	if err != nil {
-		if os.IsNotExist(err) {
+		if errors.Is(err, ErrObjectNotFound) {
 			return nil, errors.New("file not found")
 		}
-		return nil, fmt.Errorf("failed to read file: %w", err)
+		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
 
-	// Check if we have at least the nonce
-	nonceSize := s.gcm.NonceSize()
-	if len(encrypted) < nonceSize {
-		return nil, errors.New("encrypted file is too small")
+	chunkSize, noncePrefix, err := readHeader(r)
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	// chunkSize is the plaintext frame size the file was written with;
+	// frames are read by their own length prefix so we don't need it for
+	// decryption, only to sanity-check the header was parsed correctly.
+	if chunkSize == 0 {
+		r.Close()
+		return nil, errors.New("invalid file header: zero chunk size")
 	}
 
-	// Split nonce and ciphertext
-	nonce := encrypted[:nonceSize]
-	ciphertext := encrypted[nonceSize:]
+	return &frameReader{
+		r:           r,
+		gcm:         s.gcm,
+		noncePrefix: noncePrefix,
+	}, nil
+}
 
-	// Decrypt
-	plaintext, err := s.gcm.Open(nil, nonce, ciphertext, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt file: %w", err)
+// FileSize returns the plaintext length recorded in a file's size
+// sidecar, e.g. for setting a Content-Length before streaming it out.
+func (s *Service) FileSize(filename string) (int64, error) {
+	if s.dedup {
+		return s.fileSizeDedup(filename)
+	}
+
+	if err := s.validateFilename(filename); err != nil {
+		return 0, fmt.Errorf("invalid filename: %w", err)
 	}
 
-	// Verify Checksum
-	checksumPath := filepath.Join(s.dataDir, filename+".sha256")
-	storedChecksumBytes, err := os.ReadFile(checksumPath)
+	r, err := s.backend.Get(filename + ".size")
 	if err != nil {
-		// Log/Warning? Fail for security mode.
-		if os.IsNotExist(err) {
-			return nil, errors.New("integrity check failed: checksum file missing")
+		if errors.Is(err, ErrObjectNotFound) {
+			return 0, errors.New("file not found")
 		}
-		return nil, fmt.Errorf("failed to read checksum: %w", err)
+		return 0, fmt.Errorf("failed to read size sidecar: %w", err)
 	}
-	storedChecksum := string(storedChecksumBytes)
+	defer r.Close()
 
-	// Hash the decrypted content
-	hasher := sha256.New()
-	hasher.Write(plaintext)
-	calculatedChecksum := hex.EncodeToString(hasher.Sum(nil))
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read size sidecar: %w", err)
+	}
 
-	if calculatedChecksum != storedChecksum {
-		return nil, fmt.Errorf("integrity check failed: hash mismatch")
+	size, err := strconv.ParseInt(strings.TrimSpace(string(raw)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("corrupt size sidecar: %w", err)
 	}
+	return size, nil
+}
 
-	return plaintext, nil
+func (fr *frameReader) Read(p []byte) (int, error) {
+	for len(fr.pending) == 0 {
+		if fr.done {
+			return 0, io.EOF
+		}
+
+		lenBuf := make([]byte, 4)
+		if _, err := io.ReadFull(fr.r, lenBuf); err != nil {
+			return 0, fmt.Errorf("failed to read frame length: %w", err)
+		}
+		sealed := make([]byte, binary.BigEndian.Uint32(lenBuf))
+		if _, err := io.ReadFull(fr.r, sealed); err != nil {
+			return 0, fmt.Errorf("failed to read frame: %w", err)
+		}
+
+		// We don't know up front which frame is final, so authenticate
+		// against the non-final AAD first and fall back to the final one;
+		// the GCM tag itself is the arbiter of which this frame really is.
+		nonce := frameNonce(fr.noncePrefix, fr.counter)
+		chunk, err := fr.gcm.Open(nil, nonce, sealed, frameAAD(fr.counter, false))
+		final := false
+		if err != nil {
+			chunk, err = fr.gcm.Open(nil, nonce, sealed, frameAAD(fr.counter, true))
+			final = true
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to decrypt frame %d: %w", fr.counter, err)
+		}
+
+		fr.counter++
+		fr.pending = chunk
+
+		if final {
+			fr.done = true
+		}
+	}
+
+	n := copy(p, fr.pending)
+	fr.pending = fr.pending[n:]
+	return n, nil
+}
+
+func (fr *frameReader) Close() error {
+	return fr.r.Close()
 }
 
 // FileExists checks if an encrypted file exists
@@ -190,7 +465,32 @@ func (s *Service) FileExists(filename string) bool {
 	if err := s.validateFilename(filename); err != nil {
 		return false
 	}
-	filePath := filepath.Join(s.dataDir, filename+".enc")
-	_, err := os.Stat(filePath)
+	if s.dedup {
+		_, err := s.backend.Stat(dedupManifestName(filename))
+		return err == nil
+	}
+	_, err := s.backend.Stat(filename + ".enc")
 	return err == nil
 }
+
+// DeleteFile removes filename's stored data via the service's Backend. In
+// dedup mode (see dedup.go) this decrements the reference count on each of
+// the file's chunks and garbage-collects any chunk that drops to zero
+// references, rather than deleting a single object.
+func (s *Service) DeleteFile(filename string) error {
+	if err := s.validateFilename(filename); err != nil {
+		return fmt.Errorf("invalid filename: %w", err)
+	}
+
+	if s.dedup {
+		return s.deleteFileDedup(filename)
+	}
+
+	if err := s.backend.Delete(filename + ".enc"); err != nil && !errors.Is(err, ErrObjectNotFound) {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	if err := s.backend.Delete(filename + ".size"); err != nil && !errors.Is(err, ErrObjectNotFound) {
+		return fmt.Errorf("failed to delete size sidecar: %w", err)
+	}
+	return nil
+}
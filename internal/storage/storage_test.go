@@ -2,9 +2,13 @@ package storage
 
 import (
 	"bytes"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
+	"time"
 )
 
 func TestValidateFilename(t *testing.T) {
@@ -66,15 +70,9 @@ func TestSaveAndLoadFile(t *testing.T) {
 		t.Fatalf("Encrypted file was not created")
 	}
 
-	// Verify the checksum file exists
-	checksumPath := filepath.Join(tmpDir, filename+".sha256")
-	if _, err := os.Stat(checksumPath); os.IsNotExist(err) {
-		t.Fatalf("Checksum file was not created")
-	}
-
 	// Verify stored data is encrypted (not plaintext)
 	storedData, _ := os.ReadFile(encPath)
-	if string(storedData) == string(testData) {
+	if bytes.Contains(storedData, testData) {
 		t.Error("Data was stored in plaintext, not encrypted!")
 	}
 
@@ -90,6 +88,112 @@ func TestSaveAndLoadFile(t *testing.T) {
 	}
 }
 
+func TestSaveAndLoadFileMultiChunk(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "storage_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	svc, err := NewService("12345678901234567890123456789012", tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	// Use a tiny chunk size so a modest test payload spans many frames.
+	svc.chunkSize = 16
+
+	testData := bytes.Repeat([]byte("0123456789abcdef"), 100)
+	filename := "multichunk.bin"
+
+	if err := svc.SaveFile(filename, bytes.NewReader(testData)); err != nil {
+		t.Fatalf("SaveFile failed: %v", err)
+	}
+
+	loadedData, err := svc.LoadFile(filename)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if !bytes.Equal(loadedData, testData) {
+		t.Error("Loaded data does not match original for multi-chunk file")
+	}
+}
+
+func TestOpenFileStreaming(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "storage_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	svc, err := NewService("12345678901234567890123456789012", tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	svc.chunkSize = 16
+
+	testData := bytes.Repeat([]byte("streaming-data-"), 50)
+	filename := "stream.bin"
+
+	if err := svc.SaveFile(filename, bytes.NewReader(testData)); err != nil {
+		t.Fatalf("SaveFile failed: %v", err)
+	}
+
+	rc, err := svc.OpenFile(filename)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer rc.Close()
+
+	streamed, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("reading from OpenFile failed: %v", err)
+	}
+	if !bytes.Equal(streamed, testData) {
+		t.Error("streamed data does not match original")
+	}
+
+	size, err := svc.FileSize(filename)
+	if err != nil {
+		t.Fatalf("FileSize failed: %v", err)
+	}
+	if size != int64(len(testData)) {
+		t.Errorf("FileSize = %d, want %d", size, len(testData))
+	}
+}
+
+func TestLoadFileDetectsTamperedFrame(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "storage_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	svc, err := NewService("12345678901234567890123456789012", tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+
+	filename := "tampered.txt"
+	if err := svc.SaveFile(filename, bytes.NewReader([]byte("some secret content"))); err != nil {
+		t.Fatalf("SaveFile failed: %v", err)
+	}
+
+	encPath := filepath.Join(tmpDir, filename+".enc")
+	encrypted, err := os.ReadFile(encPath)
+	if err != nil {
+		t.Fatalf("failed to read encrypted file: %v", err)
+	}
+	// Flip a byte well past the header, inside the first frame's ciphertext.
+	encrypted[len(encrypted)-1] ^= 0xFF
+	if err := os.WriteFile(encPath, encrypted, 0600); err != nil {
+		t.Fatalf("failed to write tampered file: %v", err)
+	}
+
+	if _, err := svc.LoadFile(filename); err == nil {
+		t.Error("expected error loading tampered file, got nil")
+	}
+}
+
 func TestLoadNonExistentFile(t *testing.T) {
 	tmpDir, _ := os.MkdirTemp("", "storage_test")
 	defer os.RemoveAll(tmpDir)
@@ -121,3 +225,43 @@ func TestFileExists(t *testing.T) {
 		t.Error("FileExists returned false for existing file")
 	}
 }
+
+// failingPutBackend fails every Put immediately without reading r to EOF,
+// mimicking LocalBackend.Put giving up partway through io.Copy on a write
+// error (e.g. disk full).
+type failingPutBackend struct {
+	Backend
+}
+
+func (b *failingPutBackend) Put(name string, r io.Reader) error {
+	return errors.New("simulated write failure")
+}
+
+func TestSaveFileDoesNotLeakGoroutineOnBackendPutError(t *testing.T) {
+	tmpDir, _ := os.MkdirTemp("", "storage_test")
+	defer os.RemoveAll(tmpDir)
+
+	svc, err := NewServiceWithBackend("12345678901234567890123456789012", &failingPutBackend{Backend: NewLocalBackend(tmpDir)})
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	svc.chunkSize = 16
+
+	before := runtime.NumGoroutine()
+
+	testData := bytes.Repeat([]byte("0123456789abcdef"), 100)
+	if err := svc.SaveFile("big.bin", bytes.NewReader(testData)); err == nil {
+		t.Fatal("expected SaveFile to return the backend's error")
+	}
+
+	// encodeFrames's goroutine should unblock and exit promptly once
+	// SaveFile sees the backend error, rather than staying parked forever
+	// on a pw.Write the reader side will never drain.
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("goroutine count stayed elevated (%d > %d) after SaveFile returned", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}